@@ -0,0 +1,375 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultAgentFiles are the agents PixelHeat ships with. Files in the user
+// and project agent directories add to them or replace them by name.
+//
+//go:embed agents/*.md
+var defaultAgentFiles embed.FS
+
+// Directory, relative to the project, with the project's own agents
+const projectAgentsDir = ".pixelheat/agents"
+
+// Temperature used when an agent doesn't set one
+const defaultTemperature = 0.7
+
+// agentTools are the tools an agent can list in its definition.
+var agentTools = map[string]string{
+	"edits":  "always ask for file edits in the format PixelHeat can apply, not only while a task is running",
+	"memory": "remember facts, decisions and conventions of the project across sessions",
+}
+
+// The loaded agents, replaced whenever the definition files change
+var (
+	agentsMu    sync.RWMutex
+	aiAgents    []*AIAgent
+	agentErrors []error
+)
+
+// getAIAgents returns the loaded agents.
+func getAIAgents() []*AIAgent {
+	agentsMu.RLock()
+	defer agentsMu.RUnlock()
+	return aiAgents
+}
+
+// getAgentErrors returns the problems found in agent definition files.
+func getAgentErrors() []error {
+	agentsMu.RLock()
+	defer agentsMu.RUnlock()
+	return agentErrors
+}
+
+// agentDirs returns the directories agent definitions are read from, in the
+// order they override each other.
+func agentDirs(projectDir string) []string {
+	var dirs []string
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "pixelheat", "agents"))
+	}
+	return append(dirs, filepath.Join(projectDir, projectAgentsDir))
+}
+
+// isAgentFile reports whether a file name looks like an agent definition.
+func isAgentFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// agentFilesStamp summarises the names, sizes and modification times of the
+// agent files, so a change in any of them can be noticed cheaply.
+func agentFilesStamp(dirs []string) string {
+	var sb strings.Builder
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isAgentFile(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("%s/%s:%d:%d;", dir, entry.Name(), info.Size(), info.ModTime().UnixNano()))
+		}
+	}
+	return sb.String()
+}
+
+// loadAgents reads the default agents and those in dirs. Invalid files are
+// skipped and reported; later definitions replace earlier ones with the same name.
+func loadAgents(dirs []string) ([]*AIAgent, []error) {
+	var agents []*AIAgent
+	var errs []error
+	add := func(agent *AIAgent) {
+		for i, existing := range agents {
+			if existing.Name == agent.Name {
+				agents[i] = agent
+				return
+			}
+		}
+		agents = append(agents, agent)
+	}
+
+	defaults, _ := fs.Glob(defaultAgentFiles, "agents/*.md")
+	sort.Strings(defaults)
+	for _, name := range defaults {
+		data, _ := defaultAgentFiles.ReadFile(name)
+		agent, err := parseAgent(name, string(data))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		add(agent)
+	}
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue // Agent directories are optional
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isAgentFile(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			agent, err := parseAgent(path, string(data))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			add(agent)
+		}
+	}
+	return agents, errs
+}
+
+// reloadAgents replaces the loaded agents with those defined in dirs.
+func reloadAgents(dirs []string) {
+	agents, errs := loadAgents(dirs)
+	agentsMu.Lock()
+	defer agentsMu.Unlock()
+	aiAgents = agents
+	agentErrors = errs
+}
+
+// configValue is a value in an agent definition, either text or a list.
+type configValue struct {
+	Text   string
+	List   []string
+	IsList bool
+}
+
+// Strings returns a list value, or a text value as a single item list.
+func (v configValue) Strings() []string {
+	if v.IsList {
+		return v.List
+	}
+	if v.Text == "" {
+		return nil
+	}
+	return []string{v.Text}
+}
+
+// parseAgent reads an agent from Markdown with a frontmatter block, whose
+// body is the directive, or from a YAML file with a directive key.
+func parseAgent(path, content string) (*AIAgent, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	var fields map[string]configValue
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".md") {
+		rest, found := strings.CutPrefix(content, "---\n")
+		if !found {
+			return nil, fmt.Errorf("%s: missing frontmatter, start the file with a --- line", path)
+		}
+		header, body, found := strings.Cut(rest, "\n---")
+		if !found {
+			return nil, fmt.Errorf("%s: frontmatter is not closed with a --- line", path)
+		}
+		if fields, err = parseConfigFields(header); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if _, ok := fields["directive"]; ok {
+			return nil, fmt.Errorf("%s: the directive is the text after the frontmatter, not a field", path)
+		}
+		// Drop the rest of the closing --- line
+		if _, after, ok := strings.Cut(body, "\n"); ok {
+			body = after
+		} else {
+			body = ""
+		}
+		fields["directive"] = configValue{Text: strings.TrimSpace(body)}
+	} else if fields, err = parseConfigFields(content); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	agent, err := agentFromFields(fields)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	agent.Source = path
+	return agent, nil
+}
+
+// parseConfigFields parses the small YAML subset agent files use: "key: value",
+// "key: [a, b]", a key followed by "- item" lines, and "key: |" followed by
+// an indented block of text. Lines starting with # are comments.
+func parseConfigFields(text string) (map[string]configValue, error) {
+	fields := make(map[string]configValue)
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line != strings.TrimLeft(line, " \t") {
+			return nil, fmt.Errorf("line %d: unexpected indentation", i+1)
+		}
+
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if _, exists := fields[key]; exists {
+			return nil, fmt.Errorf("line %d: %s is set twice", i+1, key)
+		}
+
+		switch {
+		case value == "|" || value == ">":
+			// Block of text, indented under the key
+			var block []string
+			for i+1 < len(lines) && (strings.TrimSpace(lines[i+1]) == "" || lines[i+1] != strings.TrimLeft(lines[i+1], " \t")) {
+				i++
+				block = append(block, strings.TrimSpace(lines[i]))
+			}
+			separator := "\n"
+			if value == ">" {
+				separator = " "
+			}
+			fields[key] = configValue{Text: strings.TrimSpace(strings.Join(block, separator))}
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: list is not closed with ]", i+1)
+			}
+			var list []string
+			for _, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					list = append(list, item)
+				}
+			}
+			fields[key] = configValue{List: list, IsList: true}
+		case value == "":
+			// Either an empty value or a list of "- item" lines
+			var list []string
+			for i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), "- ") {
+				i++
+				list = append(list, unquote(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), "- "))))
+			}
+			fields[key] = configValue{List: list, IsList: len(list) > 0}
+		default:
+			fields[key] = configValue{Text: unquote(value)}
+		}
+	}
+	return fields, nil
+}
+
+// unquote removes matching single or double quotes around a value.
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// agentFromFields validates the fields of an agent definition.
+func agentFromFields(fields map[string]configValue) (*AIAgent, error) {
+	for key := range fields {
+		switch key {
+		case "name", "directive", "services", "preferred_service", "tools", "routes":
+		default:
+			if contains(paramNames, key) {
+				continue
+			}
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+	}
+
+	agent := &AIAgent{
+		Name:      strings.TrimSpace(fields["name"].Text),
+		Directive: fields["directive"].Text,
+		Params:    defaultGenerationParams(),
+	}
+	if agent.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(agent.Directive) == "" {
+		return nil, fmt.Errorf("agent %q has no directive", agent.Name)
+	}
+	// Catch unknown variables now rather than on every request
+	tmpl, err := parseDirective(agent.Name, agent.Directive)
+	if err == nil {
+		err = tmpl.Execute(io.Discard, DirectiveData{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("agent %q has an invalid directive template: %w", agent.Name, err)
+	}
+
+	for _, modelName := range fields["services"].Strings() {
+		service := findService(modelName)
+		if service == nil {
+			return nil, fmt.Errorf("agent %q uses unknown service %q", agent.Name, modelName)
+		}
+		agent.Services = append(agent.Services, service)
+	}
+	if len(agent.Services) == 0 {
+		return nil, fmt.Errorf("agent %q needs at least one service", agent.Name)
+	}
+
+	if preferred := fields["preferred_service"].Text; preferred != "" {
+		for _, service := range agent.Services {
+			if service.ModelName == preferred {
+				agent.PrefferedService = service
+			}
+		}
+		if agent.PrefferedService == nil {
+			return nil, fmt.Errorf("agent %q prefers %q, which is not one of its services", agent.Name, preferred)
+		}
+	}
+
+	for _, name := range paramNames {
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var err error
+		if name == "stop" {
+			err = agent.Params.setStop(value.Strings())
+		} else {
+			err = agent.Params.Set(name, value.Text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("agent %q: %w", agent.Name, err)
+		}
+	}
+
+	for _, tool := range fields["tools"].Strings() {
+		if _, ok := agentTools[tool]; !ok {
+			return nil, fmt.Errorf("agent %q uses unknown tool %q", agent.Name, tool)
+		}
+		agent.Tools = append(agent.Tools, tool)
+	}
+
+	for _, route := range fields["routes"].Strings() {
+		if !contains(routeCategories, route) {
+			return nil, fmt.Errorf("agent %q routes unknown kind of request %q, use %s", agent.Name, route, strings.Join(routeCategories, ", "))
+		}
+		agent.Routes = append(agent.Routes, route)
+	}
+	return agent, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigFields(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]configValue
+		err  string
+	}{
+		{"scalars and comments", "# agent\nname: Helper\nmodel: \"gpt-4\"\n", map[string]configValue{"name": {Text: "Helper"}, "model": {Text: "gpt-4"}}, ""},
+		{"inline list", "services: [gpt-4, 'gpt-3.5-turbo']", map[string]configValue{"services": {List: []string{"gpt-4", "gpt-3.5-turbo"}, IsList: true}}, ""},
+		{"item list", "tools:\n  - memory\n  - edits\nname: x", map[string]configValue{"tools": {List: []string{"memory", "edits"}, IsList: true}, "name": {Text: "x"}}, ""},
+		{"empty value", "routes:", map[string]configValue{"routes": {}}, ""},
+		{"literal block", "directive: |\n  one\n\n  two\nname: x", map[string]configValue{"directive": {Text: "one\n\ntwo"}, "name": {Text: "x"}}, ""},
+		{"folded block", "directive: >\n  one\n  two", map[string]configValue{"directive": {Text: "one two"}}, ""},
+		{"missing colon", "name Helper", nil, "line 1: expected"},
+		{"set twice", "name: a\nname: b", nil, "line 2: name is set twice"},
+		{"stray indentation", "name: a\n  b: c", nil, "line 2: unexpected indentation"},
+		{"unclosed list", "services: [gpt-4", nil, "line 1: list is not closed"},
+	}
+	for _, tt := range tests {
+		got, err := parseConfigFields(tt.text)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseAgent(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		err     string
+	}{
+		{"markdown", "a.md", "---\nname: Helper\nservices: [gpt-4]\ntools: [memory]\n---\nBe helpful on {{.Project}}.\n", ""},
+		{"yaml", "a.yaml", "name: Helper\nservices: [gpt-4]\ndirective: |\n  Be helpful.\n", ""},
+		{"windows line endings", "a.md", "---\r\nname: Helper\r\nservices: [gpt-4]\r\n---\r\nBe helpful.\r\n", ""},
+		{"no frontmatter", "a.md", "name: Helper", "missing frontmatter"},
+		{"unclosed frontmatter", "a.md", "---\nname: Helper\n", "not closed"},
+		{"directive field in markdown", "a.md", "---\nname: Helper\nservices: [gpt-4]\ndirective: x\n---\nBody", "text after the frontmatter"},
+		{"no name", "a.md", "---\nservices: [gpt-4]\n---\nBody", "name is required"},
+		{"no directive", "a.md", "---\nname: Helper\nservices: [gpt-4]\n---\n", "has no directive"},
+		{"unknown field", "a.md", "---\nname: Helper\ncolour: red\n---\nBody", `unknown field "colour"`},
+		{"unknown service", "a.md", "---\nname: Helper\nservices: [gpt-99]\n---\nBody", `unknown service "gpt-99"`},
+		{"no services", "a.md", "---\nname: Helper\n---\nBody", "at least one service"},
+		{"preferred service not listed", "a.md", "---\nname: Helper\nservices: [gpt-4]\npreferred_service: gpt-3.5-turbo\n---\nBody", "not one of its services"},
+		{"unknown tool", "a.md", "---\nname: Helper\nservices: [gpt-4]\ntools: [hammer]\n---\nBody", `unknown tool "hammer"`},
+		{"unknown route", "a.md", "---\nname: Helper\nservices: [gpt-4]\nroutes: [poetry]\n---\nBody", "unknown kind of request"},
+		{"bad template", "a.md", "---\nname: Helper\nservices: [gpt-4]\n---\n{{.Nope}}", "invalid directive template"},
+		{"bad parameter", "a.md", "---\nname: Helper\nservices: [gpt-4]\ntemperature: hot\n---\nBody", "temperature"},
+	}
+	for _, tt := range tests {
+		agent, err := parseAgent(tt.path, tt.content)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if agent.Name != "Helper" || agent.Source != tt.path || len(agent.Services) != 1 || !strings.HasPrefix(agent.Directive, "Be helpful") {
+			t.Errorf("%s: parsed %+v", tt.name, agent)
+		}
+	}
+}
+
+func TestDefaultAgentsParse(t *testing.T) {
+	err := fs.WalkDir(defaultAgentFiles, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(defaultAgentFiles, path)
+		if err != nil {
+			return err
+		}
+		if _, err := parseAgent(path, string(content)); err != nil {
+			t.Error(err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
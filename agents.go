@@ -10,14 +10,126 @@ type AIAgent struct {
 	Directive        string
 	PrefferedService *Service
 	Services         []*Service
+	Params           GenerationParams
+	Tools            []string
+	Routes           []string // Kinds of request the router sends to this agent
+	Source           string   // File the agent was defined in
 }
 
-// AIAgent handleInput method takes a string and a stack of messages and returns a string
-func (a *AIAgent) HandleInput(input string, stack *MessageStack, core *Core) string {
+// Service returns the service the agent uses unless told otherwise.
+func (a *AIAgent) Service() *Service {
+	if a.PrefferedService != nil {
+		return a.PrefferedService
+	}
+	return a.Services[0]
+}
+
+// GenerationParams returns the agent's parameters with any set for the next
+// request in place of its own.
+func (a *AIAgent) GenerationParams(core *Core) GenerationParams {
+	return a.Params.Merge(core.GetRequestParams())
+}
+
+// HasTool reports whether the agent's definition lists a tool.
+func (a *AIAgent) HasTool(tool string) bool {
+	return contains(a.Tools, tool)
+}
+
+// RenderDirective returns the agent's directive with its template variables
+// filled in for the current project and request.
+func (a *AIAgent) RenderDirective(core *Core) string {
+	return renderDirective(a.Name, a.Directive, core.DirectiveData)
+}
+
+// SystemDirective returns the rendered directive followed by the agent's
+// memory, for agents with the memory tool.
+func (a *AIAgent) SystemDirective(core *Core) string {
+	directive := a.RenderDirective(core)
+	if !a.HasTool("memory") {
+		return directive
+	}
+	directive += "\n\n" + memoryInstructions
+	facts, err := core.GetMemory(a.Name)
+	if err != nil {
+		log.Printf("Error loading memory of %s: %v", a.Name, err)
+	}
+	if len(facts) > 0 {
+		directive += "\n\n" + memoryMessage(facts)
+	}
+	return directive
+}
 
+// AIAgent handleInput method takes a string and a stack of messages and returns a string.
+// step labels the messages when the agent runs as part of a pipeline.
+func (a *AIAgent) HandleInput(input string, stack *MessageStack, core *Core, step string) string {
+	attached := a.prepareRequest(input, stack, core, step)
+
+	service := a.Service()
+
+	// Send user's message to the API and get the response
+	response, usage := getChatCompletion(stack.getAllMessages(), service, a.GenerationParams(core))
+	stack.insertMessage(Message{
+		Role:    "assistant",
+		Content: response,
+		Agent:   a.Name,
+		Service: service.ModelName,
+		Usage:   usage,
+		Context: attached,
+		Step:    step,
+	})
+	core.RecordTurn(a.Name, service.ModelName, usage.Cost)
+	if msg, ok := stack.lastReply(); ok {
+		core.rememberFrom(msg)
+	}
+
+	return response
+}
+
+// HandleInputJSON is HandleInput for answers that must match a JSON schema.
+// Replies that don't validate are sent back with the problems found, and an
+// error is returned, and noted as the reply, if no valid answer arrives within
+// maxJSONAttempts.
+func (a *AIAgent) HandleInputJSON(input string, stack *MessageStack, core *Core, schema *JSONSchema) (string, error) {
+	attached := a.prepareRequest(input, stack, core, "")
+
+	service := a.Service()
+	response, usage, err := completeJSON(stack.getAllMessages(), service, a.GenerationParams(core), schema)
+	core.RecordTurn(a.Name, service.ModelName, usage.Cost)
+
+	// Answer the user's message with the error, so it isn't left without a reply
+	content := response
+	if err != nil {
+		content = fmt.Sprintf("Could not get an answer matching the schema: %v", err)
+	}
+	stack.insertMessage(Message{
+		Role:    "assistant",
+		Content: content,
+		Agent:   a.Name,
+		Service: service.ModelName,
+		Usage:   usage,
+		Context: attached,
+	})
+	if err != nil {
+		return "", err
+	}
+	return response, nil
+}
+
+// prepareRequest replaces the system messages with this agent's directive and
+// the active files and context, then adds the user's message. It returns the
+// names of what was attached.
+func (a *AIAgent) prepareRequest(input string, stack *MessageStack, core *Core, step string) []string {
 	//Clear the old messages
 	stack.clearMessagesByRole("system")
-	stack.insertSystemMessage(a.Directive)
+	stack.insertSystemMessage(a.SystemDirective(core))
+
+	// Tasks commit the agent's edits, so ask for them in a format we can apply
+	if task := core.GetTask(); (task != nil && task.CheckedOut) || a.HasTool("edits") {
+		stack.insertSystemMessage(editInstructions)
+	}
+
+	// Remember what was attached to this request
+	var attached []string
 
 	// Insert contents of active files as new messages
 	for _, fileNode := range core.GetActiveFiles() {
@@ -28,56 +140,74 @@ func (a *AIAgent) HandleInput(input string, stack *MessageStack, core *Core) str
 				continue
 			}
 			stack.insertSystemMessage(fmt.Sprintf("File: %s\nContent:\n%s", fileNode.Name, content))
+			attached = append(attached, fileNode.Name)
 		}
 	}
 
-	stack.insertUserMessage(input)
+	// Insert active git context sources
+	for _, source := range core.GetContextSources() {
+		if source.Active {
+			content, err := source.Content(core.projectDir)
+			if err != nil {
+				log.Printf("Error computing context %s: %v", source.Name(), err)
+				continue
+			}
+			stack.insertSystemMessage(fmt.Sprintf("Context: %s\n%s", source.Name(), content))
+			attached = append(attached, source.Name())
+		}
+	}
 
-	// Send user's message to the API and get the response
-	response, _ := getChatCompletion(stack.getAllMessages(), a.Services[0])
-	stack.insertAssistantMessage(response)
+	stack.insertMessage(Message{Role: "user", Content: input, Agent: a.Name, Context: attached, Step: step})
+	return attached
+}
 
-	return response
+// Regenerate answers the prompt of the last reply again with this agent and
+// service. The new answer becomes a sibling of the old one and the current branch.
+func (a *AIAgent) Regenerate(stack *MessageStack, core *Core, service *Service) (string, error) {
+	reply, ok := stack.lastReply()
+	if !ok {
+		return "", fmt.Errorf("there is no reply to regenerate")
+	}
+	if err := stack.branchFrom(reply.ID); err != nil {
+		return "", err
+	}
+
+	// Replay the same prompt and context, swapping in this agent's directive
+	messages := a.withDirective(stack.getAllMessages(), core)
+
+	response, usage := getChatCompletion(messages, service, a.GenerationParams(core))
+	stack.insertMessage(Message{
+		Role:    "assistant",
+		Content: response,
+		Agent:   a.Name,
+		Service: service.ModelName,
+		Usage:   usage,
+		Context: reply.Context,
+	})
+	core.RecordTurn(a.Name, service.ModelName, usage.Cost)
+
+	return response, nil
 }
 
-var aiAgents = []*AIAgent{
-	{
-		Name:      "PixelHeat",
-		Directive: "You are a meta application for helping building other applications. You are helping the user with whatever content they have selected. Follow best practices for the content you are helping with. Ask questions when neccessary.",
-		Services: []*Service{
-			GetService("gpt-4", "gpt-4"),
-		},
-	},
-	{
-		Name:      "PixelHeat (Pirate)",
-		Directive: "You are a meta application for helping building other applications. You are helping the user with whatever content they have selected. Follow best practices for the content you are helping with. Ask questions when neccessary. You only respond as a helpful pirate, do everything you can to stay in character. Never break character.",
-		Services: []*Service{
-			GetService("gpt-4", "gpt-4"),
-		},
-	},
-	{
-		Name:      "Chat Assistant (smart)",
-		Directive: "You are a helpful chat assistant. You can help with nearly anything, if you are unsure of the validity of an answer state as much.",
-		Services: []*Service{
-			GetService("gpt-4", "gpt-4"),
-			GetService("gpt-3.5", "gpt-3.5-turbo"),
-		},
-		PrefferedService: GetService("gpt-4", "gpt-4"),
-	},
-	{
-		Name:      "Chat Assistant (eh)",
-		Directive: "You are a helpful chat assistant. You can help with nearly anything, if you are unsure of the validity of an answer state as much.",
-		Services: []*Service{
-			GetService("gpt-3.5", "gpt-3.5-turbo"),
-		},
-		PrefferedService: GetService("gpt-3.5", "gpt-3.5-turbo"),
-	},
-	{
-		Name:      "Code Reviewer (friendly)",
-		Directive: "You are a friendly code reviewer. You are not too strict, but you are not too lenient either. You are a good balance of both.",
-		Services: []*Service{
-			GetService("gpt-4", "gpt-4"),
-		},
-	},
-	// ... add more agents as needed
+// withDirective returns a copy of messages with the first system message,
+// the directive of whoever prepared them, replaced by this agent's.
+func (a *AIAgent) withDirective(messages []Message, core *Core) []Message {
+	messages = append([]Message(nil), messages...)
+	for i, msg := range messages {
+		if msg.Role == "system" {
+			messages[i].Content = a.SystemDirective(core)
+			break
+		}
+	}
+	return messages
+}
+
+// findAIAgent returns the agent with the given name, or nil if there is none.
+func findAIAgent(name string) *AIAgent {
+	for _, agent := range getAIAgents() {
+		if agent.Name == name {
+			return agent
+		}
+	}
+	return nil
 }
@@ -3,76 +3,128 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 )
 
-const openaiURL = "https://api.openai.com/v1/chat/completions"
+// Chat completions endpoint, a variable so tests can point it at a local server
+var openaiURL = "https://api.openai.com/v1/chat/completions"
 
 var openaiAPIKey = os.Getenv("OPENAI_KEY")
 
-func getChatCompletion(messages []Message, service *Service) (string, float64) {
+// apiMessages strips the local metadata from messages before they are sent to the API.
+func apiMessages(messages []Message) []map[string]string {
+	var result []map[string]string
+	for _, msg := range messages {
+		result = append(result, map[string]string{"role": msg.Role, "content": msg.Content})
+	}
+	return result
+}
+
+// getChatCompletion asks a service for the next message of a conversation
+// and counts the request against the service.
+func getChatCompletion(messages []Message, service *Service, params GenerationParams) (string, Usage) {
+	content, usage, err := requestChatCompletion(messages, service, params)
+	checkError(err, "Error getting chat completion")
+	recordUsage(service, usage)
+	return content, usage
+}
+
+// requestChatCompletion asks a service for the next message of a conversation.
+// It returns errors instead of exiting and leaves the usage to be recorded by
+// the caller, so several requests can run side by side.
+func requestChatCompletion(messages []Message, service *Service, params GenerationParams) (string, Usage, error) {
 	data := map[string]interface{}{
-		"model":       service.ModelName,
-		"messages":    messages,
-		"temperature": .7,
+		"model":    service.ModelName,
+		"messages": apiMessages(messages),
 	}
+	params.apply(data)
 
 	reqBody, err := json.Marshal(data)
-	checkError(err, "Error encoding data")
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("encoding request: %w", err)
+	}
 
 	req, err := http.NewRequest("POST", openaiURL, bytes.NewBuffer(reqBody))
-	checkError(err, "Error creating request")
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("creating request: %w", err)
+	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+openaiAPIKey)
 
 	resp, err := http.DefaultClient.Do(req)
-	checkError(err, "Error making request")
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("making request: %w", err)
+	}
 	defer resp.Body.Close()
 
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("reading response body: %w", err)
+	}
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Fatalf("Received %d status from API: %s", resp.StatusCode, bodyBytes)
+		return "", Usage{}, fmt.Errorf("received %d status from API: %s", resp.StatusCode, bodyBytes)
 	}
 
 	var result map[string]interface{}
-	bodyBytes, err := io.ReadAll(resp.Body)
-	checkError(err, "Error reading response body")
-
-	err = json.Unmarshal(bodyBytes, &result)
-	checkError(err, "Error decoding response")
+	if err := json.Unmarshal(bodyBytes, &result); err != nil {
+		return "", Usage{}, fmt.Errorf("decoding response: %w", err)
+	}
 
 	choices, ok := result["choices"].([]interface{})
 	if !ok || len(choices) == 0 {
-		log.Fatal("Unexpected format: 'choices' missing or not an array")
+		return "", Usage{}, fmt.Errorf("unexpected format: 'choices' missing or not an array")
+	}
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return "", Usage{}, fmt.Errorf("unexpected format: choice[0] not a map")
+	}
+	message, ok := choice["message"].(map[string]interface{})
+	if !ok {
+		return "", Usage{}, fmt.Errorf("unexpected format: 'message' not a map")
 	}
-
-	choice, _ := choices[0].(map[string]interface{})
-	checkError(err, "Unexpected format: choice[0] not a map")
-
-	message, _ := choice["message"].(map[string]interface{})
-	checkError(err, "Unexpected format: 'message' not a map")
-
 	content, ok := message["content"].(string)
 	if !ok {
-		log.Fatal("Unexpected format: 'content' not a string")
+		return "", Usage{}, fmt.Errorf("unexpected format: 'content' not a string")
 	}
 
-	// Calculate cost based on the number of characters used
-	totalCharacters := 0
-	for _, msg := range messages {
-		totalCharacters += len(msg.Content)
+	usage := Usage{}
+	if reported, ok := result["usage"].(map[string]interface{}); ok {
+		// Prefer the token counts reported by the API
+		promptTokens, _ := reported["prompt_tokens"].(float64)
+		completionTokens, _ := reported["completion_tokens"].(float64)
+		usage.InputTokens = int(promptTokens)
+		usage.OutputTokens = int(completionTokens)
+	} else {
+		// Estimate based on the number of characters used
+		totalCharacters := 0
+		for _, msg := range messages {
+			totalCharacters += len(msg.Content)
+		}
+		usage.InputTokens = totalCharacters / 4 // 1 token is approximately 4 characters
+		usage.OutputTokens = len(content) / 4
 	}
-	totalTokens := float64(totalCharacters) / 4.0    // 1 token is approximately 4 characters
-	cost := totalTokens / 1000 * (service.InputCost) // Assuming cost is per 1K tokens
+	// Assuming cost is per 1K tokens
+	usage.Cost = float64(usage.InputTokens)/1000*service.InputCost + float64(usage.OutputTokens)/1000*service.OutputCost
 
-	// Increment the service usage count and total tokens processed
+	return content, usage, nil
+}
+
+// recordUsage increments the service usage count and total tokens processed.
+func recordUsage(service *Service, usage Usage) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
 	serviceUsage[service.ModelName]++
-	service.InputTokens += int(totalTokens)
-	service.OutputTokens += len(content) / 4
+	service.InputTokens += usage.InputTokens
+	service.OutputTokens += usage.OutputTokens
+}
 
-	return content, cost
+// serviceTotals returns the number of requests made to a service and the tokens it processed.
+func serviceTotals(service *Service) (requests, inputTokens, outputTokens int) {
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	return serviceUsage[service.ModelName], service.InputTokens, service.OutputTokens
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// serveCompletions points requests at a local server answering with status and body.
+func serveCompletions(t *testing.T, status int, body string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	previous := openaiURL
+	openaiURL = server.URL
+	t.Cleanup(func() {
+		openaiURL = previous
+		server.Close()
+	})
+}
+
+func TestRequestChatCompletion(t *testing.T) {
+	service := &Service{ModelName: "test", InputCost: 1, OutputCost: 2}
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		content string
+		usage   Usage
+		err     string
+	}{
+		{"reported usage", http.StatusOK, `{"choices":[{"message":{"content":"hi"}}],"usage":{"prompt_tokens":1000,"completion_tokens":500}}`, "hi", Usage{1000, 500, 2}, ""},
+		{"estimated usage", http.StatusOK, `{"choices":[{"message":{"content":"12345678"}}]}`, "12345678", Usage{1, 2, 0.005}, ""},
+		{"error status", http.StatusTooManyRequests, `{"error":"slow down"}`, "", Usage{}, "received 429 status"},
+		{"not JSON", http.StatusOK, `oops`, "", Usage{}, "decoding response"},
+		{"no choices", http.StatusOK, `{"choices":[]}`, "", Usage{}, "'choices' missing"},
+		{"no content", http.StatusOK, `{"choices":[{"message":{}}]}`, "", Usage{}, "'content' not a string"},
+	}
+	for _, tt := range tests {
+		serveCompletions(t, tt.status, tt.body)
+		content, usage, err := requestChatCompletion([]Message{{Role: "user", Content: "abcd"}}, service, GenerationParams{})
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if content != tt.content || usage != tt.usage {
+			t.Errorf("%s: got %q %+v, want %q %+v", tt.name, content, usage, tt.content, tt.usage)
+		}
+	}
+	if service.InputTokens != 0 {
+		t.Error("requestChatCompletion recorded usage itself")
+	}
+}
+
+func TestRecordUsageConcurrently(t *testing.T) {
+	service := &Service{ModelName: "test-concurrent"}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recordUsage(service, Usage{InputTokens: 2, OutputTokens: 1})
+		}()
+	}
+	wg.Wait()
+	if requests, input, output := serviceTotals(service); requests != 50 || input != 100 || output != 50 {
+		t.Errorf("got %d requests, %d|%d tokens", requests, input, output)
+	}
+}
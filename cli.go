@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runCLI runs a subcommand given on the command line instead of starting the UI.
+// It reports false when there is no subcommand.
+func runCLI(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = exportCommand(args[1:])
+	case "import":
+		err = importCommand(args[1:])
+	case "dataset":
+		err = datasetCommand(args[1:])
+	default:
+		err = fmt.Errorf("unknown command %q, available commands: export, import, dataset", args[0])
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pixelheat:", err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// exportCommand writes a saved session, the most recent by default, as Markdown, HTML or JSONL.
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "markdown", "export format: markdown, html or jsonl")
+	output := flags.String("o", "", "file to write, \"-\" for stdout (default .pixelheat/exports/<session>.<ext>)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: pixelheat export [-format markdown|html|jsonl] [-o file] [session id]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	name, err := exportFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	var session *Session
+	if flags.NArg() > 0 {
+		if session, err = loadSession(".", flags.Arg(0)); err != nil {
+			return err
+		}
+	} else {
+		sessions, err := listSessions(".")
+		if err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return fmt.Errorf("no saved sessions in %s", sessionsDir)
+		}
+		session = sessions[0]
+	}
+
+	if *output == "-" {
+		content, err := exportSession(session, name)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.WriteString(content)
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		path = exportPath(".", session, name)
+	}
+	if err := writeExport(session, name, path); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %s to %s\n", session.Name, path)
+	return nil
+}
+
+// importCommand saves a JSONL export as a new session that can be resumed in the UI.
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: pixelheat import <file.jsonl>")
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("import needs exactly one file")
+	}
+
+	session, err := importSession(".", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d messages as session %s (%s)\n", len(session.Messages), session.ID, session.Name)
+	return nil
+}
+
+// datasetCommand writes saved sessions, all of them by default, as a fine-tuning dataset.
+func datasetCommand(args []string) error {
+	flags := flag.NewFlagSet("dataset", flag.ExitOnError)
+	perTurn := flags.Bool("turns", false, "one example per answer instead of one per session")
+	goodOnly := flags.Bool("good", false, "only train on answers rated good")
+	agent := flags.String("agent", "", "only train on answers from this agent")
+	epochs := flags.Int("epochs", defaultTrainingEpochs, "epochs used for the cost estimate")
+	output := flags.String("o", "", "file to write (default .pixelheat/datasets/<time>.jsonl)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: pixelheat dataset [-turns] [-good] [-agent name] [-epochs n] [-o file] [session id...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var sessions []*Session
+	if flags.NArg() > 0 {
+		for _, id := range flags.Args() {
+			session, err := loadSession(".", id)
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, session)
+		}
+	} else {
+		var err error
+		if sessions, err = listSessions("."); err != nil {
+			return err
+		}
+	}
+
+	path := *output
+	if path == "" {
+		path = datasetPath(".")
+	}
+	// Examples start with the directive of the agent that answered
+	reloadAgents(agentDirs("."))
+	options := DatasetOptions{PerTurn: *perTurn, GoodOnly: *goodOnly, Agent: *agent, Epochs: *epochs, Directive: datasetDirective(".")}
+	report, err := writeDataset(sessions, options, path)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+	return nil
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Where /pr writes the description unless told otherwise
+const defaultPullRequestFile = ".pixelheat/pr-description.md"
+
+// Command is an action run by typing "/name args" in the input field.
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	Run         func(ui *UI, core *Core, args []string) (string, error)
+}
+
+// commands is the collection of slash commands; "/help" lists them.
+var commands = []*Command{
+	{
+		Name:        "task",
+		Usage:       "/task [start|back|resume|merge|discard]",
+		Description: "Commit accepted edits to a branch named after the session, then merge or discard it",
+		Run:         runTaskCommand,
+	},
+	{
+		Name:        "pr",
+		Usage:       "/pr <base branch> [file|clipboard]",
+		Description: "Draft a PR title, description, testing notes and changelog entry from the commits since base",
+		Run:         runPullRequestCommand,
+	},
+	{
+		Name:        "attach",
+		Usage:       "/attach diff <branch> | log [n] | blame <file>",
+		Description: "Add a git context source to the Tracked Files tree",
+		Run:         runAttachCommand,
+	},
+	{
+		Name:        "review",
+		Usage:       "/review [base branch]",
+		Description: "Ask the code reviewer for findings on the staged diff, or the diff against a branch",
+		Run:         runReviewCommand,
+	},
+	{
+		Name:        "session",
+		Usage:       "/session [list|new|resume <id>|rename <name>|delete <id>]",
+		Description: "Show, switch, rename or delete saved sessions",
+		Run:         runSessionCommand,
+	},
+	{
+		Name:        "sessions",
+		Usage:       "/sessions",
+		Description: "Pick a saved session to resume",
+		Run: func(ui *UI, core *Core, args []string) (string, error) {
+			ui.App.QueueUpdateDraw(func() {
+				ui.ShowSessionPicker(core)
+			})
+			return "", nil
+		},
+	},
+	{
+		Name:        "regenerate",
+		Usage:       "/regenerate [agent|model]",
+		Description: "Answer the last prompt again with another agent or model, keeping both answers",
+		Run:         runRegenerateCommand,
+	},
+	{
+		Name:        "rate",
+		Usage:       "/rate good|bad|clear",
+		Description: "Rate the last answer for fine-tuning datasets",
+		Run:         runRateCommand,
+	},
+	{
+		Name:        "dataset",
+		Usage:       "/dataset",
+		Description: "Pick sessions and write them as a fine-tuning dataset with a cost estimate",
+		Run: func(ui *UI, core *Core, args []string) (string, error) {
+			ui.App.QueueUpdateDraw(func() {
+				ui.ShowDatasetBuilder(core)
+			})
+			return "", nil
+		},
+	},
+	{
+		Name:        "search",
+		Usage:       "/search [words] [role:<role>] [agent:<name>] [after:<date>] [before:<date>]",
+		Description: "Search the messages of every saved session and jump to one",
+		Run: func(ui *UI, core *Core, args []string) (string, error) {
+			ui.App.QueueUpdateDraw(func() {
+				ui.ShowSearch(core, strings.Join(args, " "))
+			})
+			return "", nil
+		},
+	},
+	{
+		Name:        "pipeline",
+		Usage:       "/pipeline [list|off|active|<name>|<agent> > <agent> ... [until <text>]]",
+		Description: "Chain agents on each prompt, each answering the output of the one before",
+		Run:         runPipelineCommand,
+	},
+	{
+		Name:        "route",
+		Usage:       "/route [off|rules|model]",
+		Description: "Send each prompt to the agent suited to it, classified by keyword rules or a cheap model",
+		Run:         runRouteCommand,
+	},
+	{
+		Name:        "debate",
+		Usage:       "/debate [rounds] <question>",
+		Description: "Have the first active agent propose and the second critique for some rounds, then a third summarise",
+		Run:         runDebateCommand,
+	},
+	{
+		Name:        "memory",
+		Usage:       "/memory [agent]",
+		Description: "View, edit and delete what an agent remembers about the project",
+		Run:         runMemoryCommand,
+	},
+	{
+		Name:        "params",
+		Usage:       "/params [clear|name=value ...]",
+		Description: "Set temperature, top_p, max_tokens, stop, presence_penalty, frequency_penalty or seed for the next prompt",
+		Run:         runParamsCommand,
+	},
+	{
+		Name:        "json",
+		Usage:       "/json <schema file> <prompt>",
+		Description: "Ask the first active agent for an answer matching a JSON Schema, asking again while it doesn't",
+		Run:         runJSONCommand,
+	},
+	{
+		Name:        "plan",
+		Usage:       "/plan [<change>|clear]",
+		Description: "Have the first active agent plan a change as a checklist, then run and approve it step by step",
+		Run:         runPlanCommand,
+	},
+	// ... add more commands as needed
+}
+
+// findCommand returns the command with the given name, or nil if there is none.
+func findCommand(name string) *Command {
+	for _, command := range commands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+// isCommand reports whether the input is a slash command rather than a prompt.
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), "/")
+}
+
+// runCommand parses and runs a slash command, returning its output.
+func runCommand(ui *UI, core *Core, input string) (string, error) {
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(input), "/"))
+	if len(fields) == 0 || fields[0] == "help" {
+		return commandHelp(), nil
+	}
+
+	command := findCommand(fields[0])
+	if command == nil {
+		return "", fmt.Errorf("unknown command /%s, try /help", fields[0])
+	}
+	return command.Run(ui, core, fields[1:])
+}
+
+// commandHelp lists the available commands.
+func commandHelp() string {
+	var lines []string
+	for _, command := range commands {
+		lines = append(lines, fmt.Sprintf("%s - %s", command.Usage, command.Description))
+	}
+	sort.Strings(lines)
+	return "Commands:\n" + strings.Join(lines, "\n")
+}
+
+func runTaskCommand(ui *UI, core *Core, args []string) (string, error) {
+	action := ""
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "":
+		task := core.GetTask()
+		if task == nil {
+			return "No task is running. Use /task start to create one.", nil
+		}
+		where := task.BaseBranch.Short()
+		if task.CheckedOut {
+			where = task.Branch.Short()
+		}
+		return fmt.Sprintf("Task %s from %s, %d commit(s), on %s", task.Branch.Short(), task.BaseBranch.Short(), task.Commits, where), nil
+	case "start":
+		task, err := core.StartTask()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Started task on %s, accepted edits will be committed there", task.Branch.Short()), nil
+	case "back":
+		if err := core.SwitchTask(false); err != nil {
+			return "", err
+		}
+		return "Switched back to " + core.GetTask().BaseBranch.Short(), nil
+	case "resume":
+		if err := core.SwitchTask(true); err != nil {
+			return "", err
+		}
+		return "Switched to " + core.GetTask().Branch.Short(), nil
+	case "merge":
+		task := core.GetTask()
+		if task == nil {
+			return "", fmt.Errorf("no task is running")
+		}
+		if err := core.MergeTask(); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Merged %s into %s", task.Branch.Short(), task.BaseBranch.Short()), nil
+	case "discard":
+		task := core.GetTask()
+		if task == nil {
+			return "", fmt.Errorf("no task is running")
+		}
+		ui.App.QueueUpdateDraw(func() {
+			ui.Confirm(fmt.Sprintf("Delete %s and its %d commit(s)?", task.Branch.Short(), task.Commits), func() {
+				if err := core.DiscardTask(); err != nil {
+					ui.ShowMessage(fmt.Sprintf("Could not discard task: %v", err))
+					return
+				}
+				ui.AppendNote("Discarded " + task.Branch.Short())
+			})
+		})
+		return "", nil
+	default:
+		return "", fmt.Errorf("unknown task action %q", action)
+	}
+}
+
+func runPullRequestCommand(ui *UI, core *Core, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: /pr <base branch> [file|clipboard]")
+	}
+	target := defaultPullRequestFile
+	if len(args) > 1 {
+		target = args[1]
+	}
+
+	description, err := core.GeneratePullRequest(args[0])
+	if err != nil {
+		return "", err
+	}
+	title := strings.SplitN(description, "\n", 2)[0]
+
+	if target == "clipboard" {
+		if err := copyToClipboard(description); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Copied PR description to the clipboard: %s", title), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(target, []byte(description+"\n"), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Wrote PR description to %s: %s", target, title), nil
+}
+
+func runAttachCommand(ui *UI, core *Core, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: /attach diff <branch> | log [n] | blame <file>")
+	}
+
+	var source *ContextSource
+	switch args[0] {
+	case "diff":
+		if len(args) < 2 {
+			return "", fmt.Errorf("usage: /attach diff <branch>")
+		}
+		source = &ContextSource{Kind: contextBranchDiff, Arg: args[1]}
+	case "log":
+		n := defaultLogCommits
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n <= 0 {
+				return "", fmt.Errorf("invalid commit count %q", args[1])
+			}
+		}
+		source = &ContextSource{Kind: contextLog, Arg: strconv.Itoa(n)}
+	case "blame":
+		if len(args) < 2 {
+			return "", fmt.Errorf("usage: /attach blame <file>")
+		}
+		source = &ContextSource{Kind: contextBlame, Arg: args[1]}
+	default:
+		return "", fmt.Errorf("unknown context source %q", args[0])
+	}
+
+	if _, err := source.Content(core.projectDir); err != nil {
+		return "", err
+	}
+	core.AddContextSource(source)
+	return fmt.Sprintf("Added %q to Git Context, select it to attach it to requests", source.Name()), nil
+}
+
+func runReviewCommand(ui *UI, core *Core, args []string) (string, error) {
+	base := ""
+	if len(args) > 0 {
+		base = args[0]
+	}
+
+	findings, err := core.ReviewChanges(base)
+	if err != nil {
+		return "", err
+	}
+
+	ui.App.QueueUpdateDraw(func() {
+		ui.ShowReview(findings)
+	})
+	return fmt.Sprintf("Review finished with %d finding(s)", len(findings)), nil
+}
+
+func runRegenerateCommand(ui *UI, core *Core, args []string) (string, error) {
+	if len(args) == 0 {
+		ui.App.QueueUpdateDraw(func() {
+			ui.ShowRegenerate(core)
+		})
+		return "", nil
+	}
+
+	// Agent names contain spaces, model names don't
+	name := strings.Join(args, " ")
+	agent, model := "", ""
+	switch {
+	case findAIAgent(name) != nil:
+		agent = name
+	case findService(name) != nil:
+		model = name
+	default:
+		return "", fmt.Errorf("no agent or model named %q", name)
+	}
+
+	if _, err := core.Regenerate(agent, model); err != nil {
+		return "", err
+	}
+	ui.App.QueueUpdateDraw(func() {
+		ui.RenderConversation(core)
+	})
+	return "Regenerated, use [ and ] on the reply in Chat Tracking to switch between the answers", nil
+}
+
+func runRateCommand(ui *UI, core *Core, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: /rate good|bad|clear")
+	}
+	reply, ok := core.GetStack().lastReply()
+	if !ok {
+		return "", fmt.Errorf("there is no answer to rate")
+	}
+
+	rating := args[0]
+	if rating == "clear" {
+		rating = ""
+	}
+	if err := core.RateMessage(reply.ID, rating); err != nil {
+		return "", err
+	}
+	ui.App.QueueUpdateDraw(func() {
+		ui.RenderConversation(core)
+	})
+	return "", nil
+}
+
+func runSessionCommand(ui *UI, core *Core, args []string) (string, error) {
+	action := ""
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "":
+		session := core.GetSession()
+		return fmt.Sprintf("Current session %s: %s", session.ID, session.Summary()), nil
+	case "list":
+		sessions, err := listSessions(core.projectDir)
+		if err != nil {
+			return "", err
+		}
+		if len(sessions) == 0 {
+			return "No saved sessions", nil
+		}
+		var lines []string
+		for _, session := range sessions {
+			lines = append(lines, fmt.Sprintf("%s  %s", session.ID, session.Summary()))
+		}
+		return strings.Join(lines, "\n"), nil
+	case "new":
+		ui.App.QueueUpdateDraw(func() {
+			ui.LoadSession(core, core.NewSession())
+		})
+		return "", nil
+	case "resume":
+		if len(args) < 2 {
+			return "", fmt.Errorf("usage: /session resume <id>")
+		}
+		ui.App.QueueUpdateDraw(func() {
+			ui.ResumeSession(core, args[1])
+		})
+		return "", nil
+	case "rename":
+		if len(args) < 2 {
+			return "", fmt.Errorf("usage: /session rename <name>")
+		}
+		name := strings.Join(args[1:], " ")
+		if err := core.RenameSession(name); err != nil {
+			return "", err
+		}
+		return "Renamed session to " + name, nil
+	case "delete":
+		if len(args) < 2 {
+			return "", fmt.Errorf("usage: /session delete <id>")
+		}
+		if err := core.DeleteSession(args[1]); err != nil {
+			return "", err
+		}
+		return "Deleted session " + args[1], nil
+	default:
+		return "", fmt.Errorf("unknown session action %q", action)
+	}
+}
+
+func runPipelineCommand(ui *UI, core *Core, args []string) (string, error) {
+	spec := strings.Join(args, " ")
+	switch spec {
+	case "":
+		if pipeline := core.GetPipeline(); pipeline != nil {
+			return fmt.Sprintf("Prompts go through %s: %s", pipeline.Name, pipeline), nil
+		}
+		return "No pipeline selected, prompts go to the first active agent", nil
+	case "list":
+		loaded := getPipelines()
+		if len(loaded) == 0 {
+			return fmt.Sprintf("No pipelines defined, add them to %s", projectPipelinesDir), nil
+		}
+		var lines []string
+		for _, pipeline := range loaded {
+			lines = append(lines, fmt.Sprintf("%s: %s", pipeline.Name, pipeline))
+		}
+		return "Pipelines:\n" + strings.Join(lines, "\n"), nil
+	case "off":
+		core.SetPipeline(nil)
+		return "Pipeline off, prompts go to the first active agent", nil
+	}
+
+	pipeline := findPipeline(spec)
+	if pipeline == nil && spec == "active" {
+		// Chain the active agents in the order they were selected
+		var steps []string
+		for _, agent := range core.GetActiveAIAgents() {
+			steps = append(steps, agent.Name)
+		}
+		if len(steps) < 2 {
+			return "", fmt.Errorf("select at least two agents in AI Agents to chain them")
+		}
+		spec = strings.Join(steps, " > ")
+	}
+	if pipeline == nil {
+		var err error
+		if pipeline, err = parsePipelineSpec(spec); err != nil {
+			return "", err
+		}
+	}
+	core.SetPipeline(pipeline)
+	return fmt.Sprintf("Prompts now go through %s: %s", pipeline.Name, pipeline), nil
+}
+
+func runRouteCommand(ui *UI, core *Core, args []string) (string, error) {
+	if len(args) == 0 {
+		return fmt.Sprintf("Routing is %s. Agents route: %s", core.GetRouting(), describeRoutes()), nil
+	}
+	switch args[0] {
+	case routingOff:
+		core.SetRouting(routingOff)
+		return "Routing off, prompts go to the first active agent unless they start with @<agent>", nil
+	case routingRules, routingModel:
+		core.SetRouting(args[0])
+		return fmt.Sprintf("Routing by %s. Agents route: %s", args[0], describeRoutes()), nil
+	}
+	return "", fmt.Errorf("usage: /route [off|rules|model]")
+}
+
+// describeRoutes lists which agent gets each kind of request.
+func describeRoutes() string {
+	var routes []string
+	for _, category := range routeCategories {
+		name := "nobody"
+		if agent := routeAgent(category, nil); agent != nil {
+			name = agent.Name
+		}
+		routes = append(routes, fmt.Sprintf("%s to %s", category, name))
+	}
+	return strings.Join(routes, ", ")
+}
+
+func runDebateCommand(ui *UI, core *Core, args []string) (string, error) {
+	rounds := defaultDebateRounds
+	if len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			rounds = n
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return "", fmt.Errorf("usage: /debate [rounds] <question>")
+	}
+
+	debate, err := core.NewDebate(strings.Join(args, " "), rounds)
+	if err != nil {
+		return "", err
+	}
+	ui.App.QueueUpdateDraw(func() {
+		ui.AppendNote(fmt.Sprintf("%s proposes, %s critiques for %d round(s), %s summarises",
+			debate.Proposer.Name, debate.Critic.Name, debate.Rounds, debate.Summariser.Name))
+	})
+
+	costs := core.RunDebate(debate, func() {
+		ui.App.QueueUpdateDraw(func() {
+			ui.RenderConversation(core)
+			ui.UpdateBackendServices()
+		})
+	})
+	return debateReport(costs), nil
+}
+
+func runMemoryCommand(ui *UI, core *Core, args []string) (string, error) {
+	name := strings.Join(args, " ")
+	if name == "" {
+		active := core.GetActiveAIAgents()
+		if len(active) == 0 {
+			return "", fmt.Errorf("usage: /memory <agent>, or select an agent first")
+		}
+		name = active[0].Name
+	}
+	agent := findAIAgent(name)
+	if agent == nil {
+		return "", fmt.Errorf("agent %q not found", name)
+	}
+
+	ui.App.QueueUpdateDraw(func() {
+		ui.ShowMemory(core, agent.Name)
+	})
+	if !agent.HasTool("memory") {
+		return fmt.Sprintf("%s doesn't have the memory tool, add \"memory\" to its tools to use what it remembers", agent.Name), nil
+	}
+	return "", nil
+}
+
+func runParamsCommand(ui *UI, core *Core, args []string) (string, error) {
+	if len(args) == 0 {
+		params := core.GetRequestParams()
+		if params.IsZero() {
+			return "The next prompt uses each agent's parameters, set them in AI Agents", nil
+		}
+		return "The next prompt uses " + params.String(), nil
+	}
+	if args[0] == "clear" {
+		core.SetRequestParams(GenerationParams{})
+		return "The next prompt uses each agent's parameters", nil
+	}
+
+	params, err := parseParamAssignments(args)
+	if err != nil {
+		return "", err
+	}
+	core.SetRequestParams(core.GetRequestParams().Merge(params))
+	return "The next prompt uses " + core.GetRequestParams().String(), nil
+}
+
+func runJSONCommand(ui *UI, core *Core, args []string) (string, error) {
+	if len(args) < 2 {
+		return "", fmt.Errorf("usage: /json <schema file> <prompt>")
+	}
+	active := core.GetActiveAIAgents()
+	if len(active) == 0 {
+		return "", fmt.Errorf("select an agent in AI Agents first")
+	}
+
+	path := args[0]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(core.projectDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	schema, err := parseJSONSchema(string(data))
+	if err != nil {
+		return "", err
+	}
+
+	_, err = active[0].AIAgent.HandleInputJSON(strings.Join(args[1:], " "), core.GetStack(), core, schema)
+	if saveErr := core.SaveSession(); saveErr != nil {
+		log.Printf("Error saving session: %v", saveErr)
+	}
+	ui.App.QueueUpdateDraw(func() {
+		ui.RenderConversation(core)
+		ui.UpdateBackendServices()
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("The answer matches %s", args[0]), nil
+}
+
+func runPlanCommand(ui *UI, core *Core, args []string) (string, error) {
+	goal := strings.Join(args, " ")
+	if goal != "" && core.PlanRunning() {
+		return "", fmt.Errorf("a step is running, change the plan once it is answered")
+	}
+	switch goal {
+	case "":
+		ui.App.QueueUpdateDraw(func() {
+			ui.ShowPlan(core, 0)
+		})
+	case "clear":
+		core.SetPlan(nil)
+		if err := core.SaveSession(); err != nil {
+			return "", err
+		}
+		return "Plan dropped", nil
+	default:
+		ui.App.QueueUpdateDraw(func() {
+			ui.MakePlan(core, goal)
+		})
+	}
+	return "", nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Kinds of context source
+const (
+	contextWorktreeDiff = "worktree-diff"
+	contextStagedDiff   = "staged-diff"
+	contextBranchDiff   = "branch-diff"
+	contextLog          = "log"
+	contextBlame        = "blame"
+)
+
+// Number of commits attached by a log source when no count is given
+const defaultLogCommits = 10
+
+// ContextSource is git derived context that can be attached to requests alongside files.
+type ContextSource struct {
+	Kind   string // One of the context* kinds
+	Arg    string // Branch, number of commits or file, depending on the kind
+	Active bool
+	Fixed  bool // Fixed sources are always listed and can't be removed
+}
+
+// Name describes the source for display.
+func (cs *ContextSource) Name() string {
+	switch cs.Kind {
+	case contextWorktreeDiff:
+		return "Working tree diff"
+	case contextStagedDiff:
+		return "Staged diff"
+	case contextBranchDiff:
+		return "Diff against " + cs.Arg
+	case contextLog:
+		return fmt.Sprintf("Last %s commits", cs.Arg)
+	case contextBlame:
+		return "Blame for " + cs.Arg
+	default:
+		return cs.Kind
+	}
+}
+
+// Content computes the current content of the source for the repository in dir.
+func (cs *ContextSource) Content(dir string) (string, error) {
+	switch cs.Kind {
+	case contextWorktreeDiff:
+		return worktreeDiff(dir)
+	case contextStagedDiff:
+		return stagedDiff(dir)
+	case contextBranchDiff:
+		history, err := currentBranchHistory(dir, cs.Arg)
+		if err != nil {
+			return "", err
+		}
+		return history.Diff, nil
+	case contextLog:
+		n, err := strconv.Atoi(cs.Arg)
+		if err != nil {
+			return "", fmt.Errorf("invalid commit count %q", cs.Arg)
+		}
+		return recentCommits(dir, n)
+	case contextBlame:
+		return blameFile(dir, cs.Arg)
+	default:
+		return "", fmt.Errorf("unknown context source %q", cs.Kind)
+	}
+}
+
+// Tokens estimates the size of the source's current content.
+func (cs *ContextSource) Tokens(dir string) int {
+	content, err := cs.Content(dir)
+	if err != nil {
+		return 0
+	}
+	return len(content) / 4
+}
+
+// defaultContextSources returns the sources that are always available.
+func defaultContextSources() []*ContextSource {
+	return []*ContextSource{
+		{Kind: contextWorktreeDiff, Fixed: true},
+		{Kind: contextStagedDiff, Fixed: true},
+	}
+}
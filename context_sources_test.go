@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestContextSourceName(t *testing.T) {
+	tests := []struct {
+		source ContextSource
+		want   string
+	}{
+		{ContextSource{Kind: contextWorktreeDiff}, "Working tree diff"},
+		{ContextSource{Kind: contextStagedDiff}, "Staged diff"},
+		{ContextSource{Kind: contextBranchDiff, Arg: "main"}, "Diff against main"},
+		{ContextSource{Kind: contextLog, Arg: "5"}, "Last 5 commits"},
+		{ContextSource{Kind: contextBlame, Arg: "a.go"}, "Blame for a.go"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.source.Name(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestContextSourceContent(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "a.txt", "one\ntwo\n")
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "a.txt", "one\nTWO\n")
+
+	// A staged change to b.txt and an unstaged one to a.txt
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("staged\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\nTWO\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source ContextSource
+		want   []string
+		not    []string
+		err    string
+	}{
+		{"worktree diff", ContextSource{Kind: contextWorktreeDiff}, []string{"+three"}, []string{"staged"}, ""},
+		{"staged diff", ContextSource{Kind: contextStagedDiff}, []string{"+staged"}, []string{"three"}, ""},
+		{"branch diff", ContextSource{Kind: contextBranchDiff, Arg: "master"}, []string{"-two", "+TWO"}, []string{"three", "staged"}, ""},
+		{"log", ContextSource{Kind: contextLog, Arg: "1"}, []string{"edit a.txt", "Author: test <test@example.com>"}, nil, ""},
+		{"blame", ContextSource{Kind: contextBlame, Arg: "a.txt"}, []string{"   1| one", "   2| TWO"}, []string{"three"}, ""},
+		{"bad log count", ContextSource{Kind: contextLog, Arg: "many"}, nil, nil, `invalid commit count "many"`},
+		{"missing branch", ContextSource{Kind: contextBranchDiff, Arg: "nope"}, nil, nil, "nope"},
+		{"missing file", ContextSource{Kind: contextBlame, Arg: "nope.txt"}, nil, nil, "not found"},
+		{"unknown kind", ContextSource{Kind: "weather"}, nil, nil, `unknown context source "weather"`},
+	}
+
+	for _, tt := range tests {
+		content, err := tt.source.Content(dir)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s: %q does not contain %q", tt.name, content, want)
+			}
+		}
+		for _, not := range tt.not {
+			if strings.Contains(content, not) {
+				t.Errorf("%s: %q should not contain %q", tt.name, content, not)
+			}
+		}
+	}
+
+	// Only one commit is listed when one is asked for
+	log, _ := (&ContextSource{Kind: contextLog, Arg: "1"}).Content(dir)
+	if strings.Count(log, "commit ") != 1 {
+		t.Errorf("got %q, want one commit", log)
+	}
+}
@@ -1,33 +1,67 @@
 package main
 
 import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 )
 
+// Name of the agent used to write commit messages unless PIXELHEAT_COMMIT_AGENT is set
+const defaultCommitAgent = "Commit Writer"
+
+// Name of the agent that drafts pull request descriptions
+const pullRequestAgent = "PR Writer"
+
 type Core struct {
 	projectDir       string
 	stack            *MessageStack
 	activeFiles      []*FileNode
+	contextSources   []*ContextSource
 	activeAIAgents   []*AIAgentNode
 	backendServices  map[string]*Service
 	serviceUsage     map[string]int
 	commitMessage    string
+	commitAgentName  string
+	session          *Session
+	task             *Task
+	pipeline         *Pipeline        // Runs instead of the first active agent when set
+	routing          string           // How prompts are routed to agents, see routingOff
+	requestParams    GenerationParams // Parameters for the next prompt only
+	planRunning      bool             // A plan step is being carried out, so the plan can't be edited
+	agentsStamp      string           // Agent and pipeline definition files the agents were loaded from
 	userInput        string
 	assistantMessage string
 	mu               sync.Mutex
 }
 
 func NewCore() *Core {
-	return &Core{
+	c := &Core{
 		projectDir:      ".",
 		stack:           &MessageStack{},
 		activeFiles:     []*FileNode{},
+		contextSources:  defaultContextSources(),
 		activeAIAgents:  []*AIAgentNode{},
 		backendServices: make(map[string]*Service),
 		serviceUsage:    make(map[string]int),
+		commitAgentName: commitAgentFromEnv(),
+		session:         newSession(),
+		routing:         routingOff,
 	}
+	c.ReloadAgents()
+	return c
+}
+
+// commitAgentFromEnv returns the commit agent configured in the environment.
+func commitAgentFromEnv() string {
+	if name := os.Getenv("PIXELHEAT_COMMIT_AGENT"); name != "" {
+		return name
+	}
+	return defaultCommitAgent
 }
 
 func (c *Core) Update() {
@@ -37,6 +71,31 @@ func (c *Core) Update() {
 	//Update files in current project
 	c.UpdateFiles()
 
+	// Pick up added, edited or deleted agent definitions
+	if agentFilesStamp(append(agentDirs(c.projectDir), pipelineDirs(c.projectDir)...)) != c.agentsStamp {
+		c.reloadAgents()
+	}
+
+}
+
+// ReloadAgents loads the agent definitions again.
+func (c *Core) ReloadAgents() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reloadAgents()
+}
+
+// reloadAgents loads the agent and pipeline definitions; the caller holds mu.
+func (c *Core) reloadAgents() {
+	dirs := agentDirs(c.projectDir)
+	c.agentsStamp = agentFilesStamp(append(dirs, pipelineDirs(c.projectDir)...))
+	reloadAgents(dirs)
+	c.applyParamOverrides()
+	// Pipelines name agents, so they are checked against the new ones
+	reloadPipelines(pipelineDirs(c.projectDir))
+	if c.pipeline != nil && c.pipeline.Source != "" {
+		c.pipeline = findPipeline(c.pipeline.Name)
+	}
 }
 
 // Update files in current project
@@ -72,26 +131,8 @@ func (c *Core) UpdateFiles() {
 		found := false
 		for _, fileNode := range c.activeFiles {
 			if fileNode.Name == fileName {
-
-				var untracked bool
-				if status.IsUntracked(fileName) {
-					untracked = true
-				}
-
 				// Update the status of the existing file node
-				file_status := status.File(fileName)
-				status_str := ""
-				if !untracked && file_status.Staging == git.Untracked &&
-					file_status.Worktree == git.Untracked {
-					file_status.Staging = git.Unmodified
-					file_status.Worktree = git.Unmodified
-					status_str = "Unmodified"
-				}
-				if file_status.Worktree == git.Modified {
-					status_str = "Modified"
-				}
-
-				fileNode.Status = status_str
+				fileNode.Status = fileStatusString(status, fileName)
 				found = true
 				break
 			}
@@ -104,25 +145,950 @@ func (c *Core) UpdateFiles() {
 	}
 }
 
-// Handle Input
-func (c *Core) HandleInput(input string) string {
+// HandleInput sends input to the selected pipeline, or else to the first
+// active agent. onStep, if not nil, is called after each pipeline step.
+func (c *Core) HandleInput(input string, onStep func()) string {
 	// Logic for handling input
 
 	stack := c.GetStack()
 
-	//Check active agents at least 0
-	if len(c.GetActiveAIAgents()) == 0 {
-		return "No active agents."
+	var response string
+	if pipeline := c.GetPipeline(); pipeline != nil {
+		response = c.runPipeline(pipeline, input, onStep)
+	} else {
+		//Check active agents at least 0
+		if len(c.GetActiveAIAgents()) == 0 {
+			return "No active agents."
+		}
+
+		//Get the active agent
+		agent := c.GetActiveAIAgents()[0]
+
+		response = agent.AIAgent.HandleInput(input, stack, c, "")
 	}
 
-	//Get the active agent
-	agent := c.GetActiveAIAgents()[0]
+	// Autosave so quitting never loses the conversation
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
 
-	response := agent.AIAgent.HandleInput(input, stack, c)
+	return response
+}
+
+// runPipeline runs each step of a pipeline on the output of the step before,
+// stopping early when an answer meets the stop condition. It returns the last answer.
+func (c *Core) runPipeline(pipeline *Pipeline, input string, onStep func()) string {
+	stack := c.GetStack()
+	prompt := input
+	response := ""
+	step := 0
+	for round := 0; round < pipeline.Repeat; round++ {
+		for _, name := range pipeline.Steps {
+			agent := findAIAgent(name)
+			if agent == nil {
+				log.Printf("Pipeline %s stopped: agent %q not found", pipeline.Name, name)
+				return response
+			}
 
+			step++
+			label := fmt.Sprintf("%s %d/%d", pipeline.Name, step, pipeline.TotalSteps())
+			response = agent.HandleInput(prompt, stack, c, label)
+			if onStep != nil {
+				onStep()
+			}
+			if pipeline.stopsAt(response) {
+				return response
+			}
+			prompt = pipelineHandoff(agent.Name, response)
+		}
+	}
+	return response
+}
+
+// ShouldRoute reports whether the router picks the agent for input: when
+// routing is on, when no agent is active, or when the input @mentions an agent.
+func (c *Core) ShouldRoute(input string) bool {
+	if c.GetPipeline() != nil {
+		return false
+	}
+	if agent, _ := mentionedAgent(input); agent != nil {
+		return true
+	}
+	return c.GetRouting() != routingOff || len(c.GetActiveAIAgents()) == 0
+}
+
+// Route picks the agent for input, by @mention or by the kind of request.
+func (c *Core) Route(input string) (RouteDecision, error) {
+	if agent, prompt := mentionedAgent(input); agent != nil {
+		return RouteDecision{Agent: agent, Reason: "asked for by name", Prompt: prompt}, nil
+	}
+
+	decision := RouteDecision{Prompt: input}
+	if c.GetRouting() == routingModel {
+		category, usage, err := classifyByModel(input)
+		c.RecordTurn("Router", routerModel, usage.Cost)
+		if err != nil {
+			log.Printf("Error routing by model: %v", err)
+		} else {
+			decision.Category, decision.Reason = category, "classified by "+routerModel
+		}
+	}
+	if decision.Category == "" {
+		decision.Category, decision.Reason = classifyByRules(input)
+	}
+
+	active := c.GetActiveAIAgents()
+	decision.Agent = routeAgent(decision.Category, active)
+	if decision.Agent == nil {
+		// Nobody handles it, fall back to the usual agent
+		decision.Reason += ", no agent routes it"
+		if len(active) > 0 {
+			decision.Agent = active[0].AIAgent
+		} else if agents := getAIAgents(); len(agents) > 0 {
+			decision.Agent = agents[0]
+		} else {
+			return decision, fmt.Errorf("no agents are loaded, check the errors in AI Agents")
+		}
+	}
+	return decision, nil
+}
+
+// SendTo sends input to a specific agent, as chosen by the router.
+func (c *Core) SendTo(agent *AIAgent, input string) string {
+	response := agent.HandleInput(input, c.GetStack(), c, "")
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
 	return response
 }
 
+// NewDebate sets up a debate between the active agents: the first proposes,
+// the second critiques and the third, or defaultSummariser, summarises.
+func (c *Core) NewDebate(question string, rounds int) (*Debate, error) {
+	active := c.GetActiveAIAgents()
+	if len(active) < 2 {
+		return nil, fmt.Errorf("select a proposer and a critic in AI Agents, and optionally a summariser")
+	}
+	if rounds < 1 || rounds > maxDebateRounds {
+		return nil, fmt.Errorf("use 1 to %d rounds", maxDebateRounds)
+	}
+
+	debate := &Debate{Question: question, Rounds: rounds, Proposer: active[0].AIAgent, Critic: active[1].AIAgent}
+	if len(active) > 2 {
+		debate.Summariser = active[2].AIAgent
+	} else if debate.Summariser = findAIAgent(defaultSummariser); debate.Summariser == nil {
+		return nil, fmt.Errorf("select a third agent to summarise the debate")
+	}
+	return debate, nil
+}
+
+// RunDebate runs the rounds of a debate and its summary, each message going
+// into the stack. onStep, if not nil, is called after each answer.
+func (c *Core) RunDebate(debate *Debate, onStep func()) []DebateRound {
+	stack := c.GetStack()
+	answer := func(agent *AIAgent, prompt, step string) float64 {
+		agent.HandleInput(prompt, stack, c, step)
+		if onStep != nil {
+			onStep()
+		}
+		reply, _ := stack.lastReply()
+		return reply.Usage.Cost
+	}
+
+	var rounds []DebateRound
+	for round := 1; round <= debate.Rounds; round++ {
+		step := fmt.Sprintf("Debate round %d/%d", round, debate.Rounds)
+		cost := answer(debate.Proposer, debate.proposalPrompt(round), step)
+		cost += answer(debate.Critic, debate.critiquePrompt(), step)
+		rounds = append(rounds, DebateRound{Round: round, Cost: cost})
+	}
+	cost := answer(debate.Summariser, debate.summaryPrompt(), "Debate summary")
+	rounds = append(rounds, DebateRound{Cost: cost})
+
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return rounds
+}
+
+// GetMemory returns the facts an agent remembers about the project.
+func (c *Core) GetMemory(agent string) ([]MemoryFact, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return loadMemory(c.projectDir, agent)
+}
+
+// Remember adds a fact to an agent's memory, unless it is already there.
+func (c *Core) Remember(agent, text string) error {
+	return c.remember(agent, text, "")
+}
+
+// remember adds a fact taken from the answer with the given message ID.
+func (c *Core) remember(agent, text, messageID string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("nothing to remember")
+	}
+	return c.changeMemory(agent, func(facts []MemoryFact) ([]MemoryFact, error) {
+		for _, fact := range facts {
+			if strings.EqualFold(fact.Text, text) {
+				return facts, nil
+			}
+		}
+		return append(facts, MemoryFact{ID: newMessageID(), Text: text, Time: time.Now(), Message: messageID}), nil
+	})
+}
+
+// UpdateFact changes the text of a remembered fact.
+func (c *Core) UpdateFact(agent, id, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return c.ForgetFact(agent, id)
+	}
+	return c.changeMemory(agent, func(facts []MemoryFact) ([]MemoryFact, error) {
+		for i := range facts {
+			if facts[i].ID == id {
+				facts[i].Text = text
+				facts[i].Time = time.Now()
+				facts[i].Message = "" // The user's now, whichever answer is kept
+				return facts, nil
+			}
+		}
+		return nil, fmt.Errorf("fact %s not found", id)
+	})
+}
+
+// ForgetFact removes a fact from an agent's memory.
+func (c *Core) ForgetFact(agent, id string) error {
+	return c.changeMemory(agent, func(facts []MemoryFact) ([]MemoryFact, error) {
+		for i, fact := range facts {
+			if fact.ID == id {
+				return append(facts[:i], facts[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("fact %s not found", id)
+	})
+}
+
+// changeMemory loads an agent's memory, applies change and saves the result.
+func (c *Core) changeMemory(agent string, change func([]MemoryFact) ([]MemoryFact, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	facts, err := loadMemory(c.projectDir, agent)
+	if err != nil {
+		return err
+	}
+	if facts, err = change(facts); err != nil {
+		return err
+	}
+	return saveMemory(c.projectDir, agent, facts)
+}
+
+// rememberFrom stores the facts an answer asks to remember, for agents with
+// the memory tool. Only answers the conversation continues from are
+// remembered, not the alternatives of a fan-out or regenerated reply.
+func (c *Core) rememberFrom(msg Message) {
+	agent := findAIAgent(msg.Agent)
+	if agent == nil || !agent.HasTool("memory") {
+		return
+	}
+	for _, fact := range rememberedFacts(msg.Content) {
+		if err := c.remember(agent.Name, fact, msg.ID); err != nil {
+			log.Printf("Error remembering for %s: %v", agent.Name, err)
+		}
+	}
+}
+
+// forgetFrom removes the facts taken from an answer that was replaced.
+func (c *Core) forgetFrom(msg Message) {
+	agent := findAIAgent(msg.Agent)
+	if msg.Role != "assistant" || agent == nil || !agent.HasTool("memory") {
+		return
+	}
+	err := c.changeMemory(msg.Agent, func(facts []MemoryFact) ([]MemoryFact, error) {
+		var kept []MemoryFact
+		for _, fact := range facts {
+			if fact.Message != msg.ID {
+				kept = append(kept, fact)
+			}
+		}
+		return kept, nil
+	})
+	if err != nil {
+		log.Printf("Error forgetting for %s: %v", msg.Agent, err)
+	}
+}
+
+// MakePlan asks the first active agent for a step-by-step plan of a change
+// over the active files, and makes it the session's plan.
+func (c *Core) MakePlan(goal string) (*Plan, error) {
+	active := c.GetActiveAIAgents()
+	if len(active) == 0 {
+		return nil, fmt.Errorf("select an agent in AI Agents first")
+	}
+	agent := active[0].AIAgent
+
+	response, err := agent.HandleInputJSON(planPrompt(goal), c.GetStack(), c, planSchema)
+	var plan *Plan
+	if err == nil {
+		if plan, err = parsePlan(goal, agent.Name, response); err == nil {
+			c.SetPlan(plan)
+		}
+	}
+	if saveErr := c.SaveSession(); saveErr != nil {
+		log.Printf("Error saving session: %v", saveErr)
+	}
+	return plan, err
+}
+
+// RunPlanStep asks the plan's agent to carry out one step and returns its answer.
+func (c *Core) RunPlanStep(index int) (string, error) {
+	c.mu.Lock()
+	if c.planRunning {
+		c.mu.Unlock()
+		return "", fmt.Errorf("another step is running")
+	}
+	c.planRunning = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.planRunning = false
+		c.mu.Unlock()
+	}()
+
+	plan := c.GetPlan()
+	if plan == nil || index < 0 || index >= len(plan.Steps) {
+		return "", fmt.Errorf("there is no such step")
+	}
+	agent := findAIAgent(plan.Agent)
+	if agent == nil {
+		return "", fmt.Errorf("agent %q not found", plan.Agent)
+	}
+
+	// Steps are approved by applying their edits, so ask for them in a format we can apply
+	prompt := plan.stepPrompt(index)
+	if task := c.GetTask(); !agent.HasTool("edits") && (task == nil || !task.CheckedOut) {
+		prompt += "\n\n" + editInstructions
+	}
+
+	step := fmt.Sprintf("Plan step %d/%d", index+1, len(plan.Steps))
+	response := agent.HandleInput(prompt, c.GetStack(), c, step)
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return response, nil
+}
+
+// CompletePlanStep checks off a step of the plan.
+func (c *Core) CompletePlanStep(index int) {
+	c.mu.Lock()
+	plan := c.session.Plan
+	if plan != nil && index >= 0 && index < len(plan.Steps) {
+		plan.Steps[index].Done = true
+	}
+	c.mu.Unlock()
+
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+}
+
+// FanOutAnswer is one agent's answer to a prompt sent to several agents at once.
+type FanOutAnswer struct {
+	MessageID string
+	Agent     string
+	Service   string
+	Content   string
+	Latency   time.Duration
+	Cost      float64
+	Err       error // Why the agent could not answer; failed answers are not added to the conversation
+}
+
+// CanFanOut reports whether prompts go to every active agent at once, which
+// happens when several are active and no pipeline or routing is selected.
+func (c *Core) CanFanOut() bool {
+	return len(c.GetActiveAIAgents()) > 1 && c.GetPipeline() == nil && c.GetRouting() == routingOff
+}
+
+// FanOut sends the same prompt to all active agents concurrently. Each answer
+// becomes a sibling branch; the first agent's stays current until one is
+// picked. Agents that fail are reported in their answer, and an error is only
+// returned when none could answer.
+func (c *Core) FanOut(input string) ([]FanOutAnswer, error) {
+	stack := c.GetStack()
+	active := c.GetActiveAIAgents()
+	if len(active) == 0 {
+		return nil, fmt.Errorf("select an agent in AI Agents first")
+	}
+
+	// The first agent sets up the files and context, the others swap in their directive
+	attached := active[0].AIAgent.prepareRequest(input, stack, c, "")
+	messages := stack.getAllMessages()
+
+	answers := make([]FanOutAnswer, len(active))
+	usages := make([]Usage, len(active))
+	var wg sync.WaitGroup
+	for i, node := range active {
+		wg.Add(1)
+		go func(i int, agent *AIAgent) {
+			defer wg.Done()
+			service := agent.Service()
+			start := time.Now()
+			response, usage, err := requestChatCompletion(agent.withDirective(messages, c), service, agent.GenerationParams(c))
+			answers[i] = FanOutAnswer{
+				Agent:   agent.Name,
+				Service: service.ModelName,
+				Content: response,
+				Latency: time.Since(start),
+				Cost:    usage.Cost,
+				Err:     err,
+			}
+			usages[i] = usage
+		}(i, node.AIAgent)
+	}
+	wg.Wait()
+
+	// Add the answers in the order the agents were activated
+	first := ""
+	var errs []string
+	for i := range answers {
+		answer := &answers[i]
+		if answer.Err != nil {
+			log.Printf("Error getting answer of %s: %v", answer.Agent, answer.Err)
+			errs = append(errs, fmt.Sprintf("%s: %v", answer.Agent, answer.Err))
+			continue
+		}
+		recordUsage(active[i].AIAgent.Service(), usages[i])
+		if first != "" {
+			if err := stack.branchFrom(first); err != nil {
+				log.Printf("Error adding answer of %s: %v", answer.Agent, err)
+				continue
+			}
+		}
+		stack.insertMessage(Message{
+			Role:    "assistant",
+			Content: answer.Content,
+			Agent:   answer.Agent,
+			Service: answer.Service,
+			Usage:   usages[i],
+			Context: attached,
+		})
+		answer.MessageID = stack.getHead()
+		if first == "" {
+			first = answer.MessageID
+		}
+		c.RecordTurn(answer.Agent, answer.Service, answer.Cost)
+	}
+	if first == "" {
+		return answers, fmt.Errorf("no agent could answer: %s", strings.Join(errs, "; "))
+	}
+	if err := stack.showMessage(first); err != nil {
+		log.Printf("Error showing answer: %v", err)
+	}
+
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return answers, nil
+}
+
+// PickAnswer continues the conversation from one of the answers of a fan-out
+// and remembers what it asks to.
+func (c *Core) PickAnswer(id string) error {
+	stack := c.GetStack()
+	if err := stack.showMessage(id); err != nil {
+		return err
+	}
+	if msg, ok := stack.getMessage(id); ok {
+		c.rememberFrom(msg)
+	}
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return nil
+}
+
+// Regenerate answers the last prompt again with another agent or service,
+// keeping the earlier answer as an alternative branch. An empty agent name
+// reuses the agent of the last reply, an empty model its preferred service.
+func (c *Core) Regenerate(agentName, modelName string) (string, error) {
+	stack := c.GetStack()
+	reply, ok := stack.lastReply()
+	if !ok {
+		return "", fmt.Errorf("there is no reply to regenerate")
+	}
+
+	if agentName == "" {
+		agentName = reply.Agent
+	}
+	agent := findAIAgent(agentName)
+	if agent == nil {
+		return "", fmt.Errorf("agent %q not found", agentName)
+	}
+
+	service := agent.Service()
+	if modelName != "" {
+		if service = findService(modelName); service == nil {
+			return "", fmt.Errorf("model %q not found", modelName)
+		}
+	}
+
+	response, err := agent.Regenerate(stack, c, service)
+	if err != nil {
+		return "", err
+	}
+	// The new answer takes over from the old one, in memory too
+	c.forgetFrom(reply)
+	if msg, ok := stack.lastReply(); ok {
+		c.rememberFrom(msg)
+	}
+
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return response, nil
+}
+
+// SaveSession writes the conversation, active agents and active files to disk.
+func (c *Core) SaveSession() error {
+	stack := c.GetStack()
+	messages := append([]Message(nil), stack.getTree()...)
+	head := stack.getHead()
+
+	var agents []string
+	for _, agent := range c.GetActiveAIAgents() {
+		agents = append(agents, agent.Name)
+	}
+	var files []string
+	for _, file := range c.GetActiveFiles() {
+		if file.Active {
+			files = append(files, file.Name)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session.Messages = messages
+	c.session.Head = head
+	c.session.ActiveAgents = agents
+	c.session.ActiveFiles = files
+	c.session.Updated = time.Now()
+	return saveSession(c.projectDir, c.session)
+}
+
+// DirectiveData returns the project details agent directives can refer to.
+func (c *Core) DirectiveData() DirectiveData {
+	var files []string
+	for _, file := range c.GetActiveFiles() {
+		if file.Active && !file.Directory {
+			files = append(files, file.Name)
+		}
+	}
+	return projectDirectiveData(c.projectDir, files)
+}
+
+// ExportSession saves the current session and writes it in the given format,
+// to path or to the exports directory when path is empty.
+func (c *Core) ExportSession(format, path string) (string, error) {
+	if err := c.SaveSession(); err != nil {
+		return "", err
+	}
+	session := c.GetSession()
+	if path == "" {
+		path = exportPath(c.projectDir, session, format)
+	}
+	return path, writeExport(session, format, path)
+}
+
+// RateMessage marks an answer as good or bad for fine-tuning datasets and saves the session.
+func (c *Core) RateMessage(id, rating string) error {
+	if err := c.GetStack().rateMessage(id, rating); err != nil {
+		return err
+	}
+	return c.SaveSession()
+}
+
+// BuildDataset writes a fine-tuning dataset from saved sessions, including
+// the current one, to the datasets directory.
+func (c *Core) BuildDataset(ids []string, options DatasetOptions) (DatasetReport, error) {
+	if err := c.SaveSession(); err != nil {
+		return DatasetReport{}, err
+	}
+
+	var sessions []*Session
+	for _, id := range ids {
+		session, err := loadSession(c.projectDir, id)
+		if err != nil {
+			return DatasetReport{}, err
+		}
+		sessions = append(sessions, session)
+	}
+	options.Directive = datasetDirective(c.projectDir)
+	return writeDataset(sessions, options, datasetPath(c.projectDir))
+}
+
+// NewSession starts an empty conversation.
+func (c *Core) NewSession() *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stack.clearMessages()
+	c.session = newSession()
+	return c.session
+}
+
+// ResumeSession loads a saved session and continues its conversation.
+func (c *Core) ResumeSession(id string) (*Session, error) {
+	session, err := loadSession(c.projectDir, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stack.setTree(append([]Message(nil), session.Messages...), session.Head)
+	c.session = session
+	return session, nil
+}
+
+// Search saves the current session, brings the search index up to date and
+// returns the messages matching the query.
+func (c *Core) Search(query string) ([]SearchResult, error) {
+	if len(c.GetStack().getTree()) > 0 {
+		if err := c.SaveSession(); err != nil {
+			return nil, err
+		}
+	}
+	index, err := updateSearchIndex(c.projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return index.search(query)
+}
+
+// OpenMessage resumes a session on the branch containing the given message.
+func (c *Core) OpenMessage(sessionID, messageID string) (*Session, error) {
+	session, err := c.ResumeSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.GetStack().showMessage(messageID); err != nil {
+		return nil, err
+	}
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return session, nil
+}
+
+// BranchFrom makes the next request start a new branch alongside the given message.
+func (c *Core) BranchFrom(id string) error {
+	return c.GetStack().branchFrom(id)
+}
+
+// SwitchBranch continues the conversation from a sibling of the given message
+// and returns the sibling's ID.
+func (c *Core) SwitchBranch(id string, delta int) (string, error) {
+	stack := c.GetStack()
+	sibling, err := stack.switchBranch(id, delta)
+	if err != nil {
+		return id, err
+	}
+	// Keep what the answer being continued from remembers
+	previous, _ := stack.getMessage(id)
+	if current, ok := stack.getMessage(sibling); ok && current.Role == "assistant" {
+		c.forgetFrom(previous)
+		c.rememberFrom(current)
+	}
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return sibling, nil
+}
+
+// RenameSession renames the current session and saves it.
+func (c *Core) RenameSession(name string) error {
+	c.mu.Lock()
+	c.session.Name = name
+	c.mu.Unlock()
+	return c.SaveSession()
+}
+
+// DeleteSession deletes a saved session other than the current one.
+func (c *Core) DeleteSession(id string) error {
+	if c.GetSession().ID == id {
+		return fmt.Errorf("cannot delete the current session, switch to another one first")
+	}
+	return deleteSession(c.projectDir, id)
+}
+
+// RecordTurn records the agent, service and cost of a request in the session.
+func (c *Core) RecordTurn(agent, service string, cost float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session.Turns = append(c.session.Turns, Turn{Time: time.Now(), Agent: agent, Service: service, Cost: cost})
+}
+
+// GenerateCommitMessage asks the commit agent to describe the staged changes
+// and stores the result as the current commit message draft.
+func (c *Core) GenerateCommitMessage() (string, error) {
+	agent := findAIAgent(c.GetCommitAgentName())
+	if agent == nil {
+		return "", fmt.Errorf("commit agent %q not found", c.GetCommitAgentName())
+	}
+
+	diff, err := stagedDiff(c.projectDir)
+	if err != nil {
+		return "", err
+	}
+	if diff == "" {
+		return "", fmt.Errorf("nothing staged to commit")
+	}
+
+	service := agent.Service()
+	stack := &MessageStack{}
+	stack.insertSystemMessage(agent.RenderDirective(c))
+	stack.insertUserMessage("Staged diff:\n" + truncateToTokens(diff, service.Context/2))
+
+	message, usage, err := requestChatCompletion(stack.getAllMessages(), service, agent.Params)
+	if err != nil {
+		return "", err
+	}
+	recordUsage(service, usage)
+	message = strings.TrimSpace(strings.Trim(strings.TrimSpace(message), "`"))
+
+	c.SetCommitMessage(message)
+	return message, nil
+}
+
+// CommitStaged commits the staged changes with the given message and clears the draft.
+func (c *Core) CommitStaged(message string) (string, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return "", fmt.Errorf("commit message is empty")
+	}
+
+	diff, err := stagedDiff(c.projectDir)
+	if err != nil {
+		return "", err
+	}
+	if diff == "" {
+		return "", fmt.Errorf("nothing staged to commit")
+	}
+
+	hash, err := commitStaged(c.projectDir, message+"\n")
+	if err != nil {
+		return "", err
+	}
+
+	c.SetCommitMessage("")
+	return hash.String()[:8], nil
+}
+
+// GeneratePullRequest asks the PR agent to draft a title, description, testing
+// notes and changelog entry for the work on the current branch since base.
+func (c *Core) GeneratePullRequest(base string) (string, error) {
+	agent := findAIAgent(pullRequestAgent)
+	if agent == nil {
+		return "", fmt.Errorf("agent %q not found", pullRequestAgent)
+	}
+
+	history, err := currentBranchHistory(c.projectDir, base)
+	if err != nil {
+		return "", err
+	}
+	if len(history.Commits) == 0 {
+		return "", fmt.Errorf("%s has no commits that are not on %s", history.Head, base)
+	}
+
+	var commitLog strings.Builder
+	for _, commit := range history.Commits {
+		commitLog.WriteString(fmt.Sprintf("commit %s\n%s\n\n", commit.Hash.String()[:8], strings.TrimSpace(commit.Message)))
+	}
+
+	service := agent.Service()
+	stack := &MessageStack{}
+	stack.insertSystemMessage(agent.RenderDirective(c))
+	stack.insertUserMessage(fmt.Sprintf("Branch %s compared to %s.\n\nCommits:\n%s", history.Head, base, commitLog.String()))
+	stack.insertUserMessage("Aggregate diff:\n" + truncateToTokens(history.Diff, service.Context/2))
+
+	description, usage, err := requestChatCompletion(stack.getAllMessages(), service, agent.Params)
+	if err != nil {
+		return "", err
+	}
+	recordUsage(service, usage)
+	return strings.TrimSpace(description), nil
+}
+
+// ReviewChanges sends the staged diff, or the diff against base if one is
+// given, to the reviewer agent and returns its findings.
+func (c *Core) ReviewChanges(base string) ([]ReviewFinding, error) {
+	agent := findAIAgent(reviewAgent)
+	if agent == nil {
+		return nil, fmt.Errorf("agent %q not found", reviewAgent)
+	}
+
+	var patch string
+	if base == "" {
+		var err error
+		if patch, err = stagedDiff(c.projectDir); err != nil {
+			return nil, err
+		}
+	} else {
+		history, err := currentBranchHistory(c.projectDir, base)
+		if err != nil {
+			return nil, err
+		}
+		patch = history.Diff
+	}
+	if patch == "" {
+		return nil, fmt.Errorf("nothing to review")
+	}
+
+	service := agent.Service()
+	stack := &MessageStack{}
+	stack.insertSystemMessage(agent.RenderDirective(c))
+	stack.insertSystemMessage(reviewInstructions)
+	stack.insertUserMessage(truncateToTokens(numberDiffLines(patch), service.Context/2))
+
+	response, _, err := completeJSON(stack.getAllMessages(), service, agent.Params, reviewSchema)
+	if err != nil {
+		return nil, err
+	}
+	return parseReviewFindings(response)
+}
+
+// StageFile adds the working tree version of a file to the index.
+func (c *Core) StageFile(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return stageFile(c.projectDir, path)
+}
+
+// UnstageFile resets the index version of a file to HEAD.
+func (c *Core) UnstageFile(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return unstageFile(c.projectDir, path)
+}
+
+// StageHunk adds one working tree hunk of a file to the index.
+func (c *Core) StageHunk(path string, hunk int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return stageHunk(c.projectDir, path, hunk)
+}
+
+// UnstageHunk removes one staged hunk of a file from the index.
+func (c *Core) UnstageHunk(path string, hunk int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return unstageHunk(c.projectDir, path, hunk)
+}
+
+// DiscardChanges throws away the unstaged changes to a file.
+func (c *Core) DiscardChanges(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return discardChanges(c.projectDir, path)
+}
+
+// StartTask creates a branch for the current session and commits accepted edits to it.
+func (c *Core) StartTask() (*Task, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.task != nil {
+		return nil, fmt.Errorf("task %s is already running", c.task.Branch.Short())
+	}
+	task, err := startTask(c.projectDir, c.session.Name)
+	if err != nil {
+		return nil, err
+	}
+	c.task = task
+	return task, nil
+}
+
+// SwitchTask checks out either the task branch or the branch it was started from.
+func (c *Core) SwitchTask(toTask bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.task == nil {
+		return fmt.Errorf("no task is running")
+	}
+	branch := c.task.BaseBranch
+	if toTask {
+		branch = c.task.Branch
+	}
+	if err := checkoutBranch(c.projectDir, branch); err != nil {
+		// Keep track of where HEAD actually is if the checkout got part way
+		if head, headErr := headBranch(c.projectDir); headErr == nil {
+			c.task.CheckedOut = head == c.task.Branch
+		}
+		return err
+	}
+	c.task.CheckedOut = toTask
+	return nil
+}
+
+// MergeTask fast-forwards the base branch onto the task branch and ends the task.
+func (c *Core) MergeTask() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.task == nil {
+		return fmt.Errorf("no task is running")
+	}
+	if err := mergeTask(c.projectDir, c.task); err != nil {
+		return err
+	}
+	c.task = nil
+	return nil
+}
+
+// DiscardTask deletes the task branch and its commits and ends the task.
+func (c *Core) DiscardTask() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.task == nil {
+		return fmt.Errorf("no task is running")
+	}
+	if err := discardTask(c.projectDir, c.task); err != nil {
+		return err
+	}
+	c.task = nil
+	return nil
+}
+
+// ApplyEdits writes accepted edits to disk and commits them to the task
+// branch, starting a task for the session if none is running, so the edits
+// can be discarded with the branch.
+func (c *Core) ApplyEdits(edits []FileEdit, prompt string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	started := ""
+	if c.task == nil {
+		task, err := startTask(c.projectDir, c.session.Name)
+		if err != nil {
+			return "", fmt.Errorf("could not start a task for the edits: %w", err)
+		}
+		c.task = task
+		started = fmt.Sprintf("Started task on %s. ", task.Branch.Short())
+	} else if !c.task.CheckedOut {
+		return "", fmt.Errorf("task branch %s is not checked out, use /task resume first", c.task.Branch.Short())
+	}
+	if err := checkStagedEdits(c.projectDir, edits); err != nil {
+		return "", err
+	}
+	if err := applyFileEdits(c.projectDir, edits); err != nil {
+		return "", err
+	}
+
+	hash, err := commitTaskEdits(c.projectDir, c.task, edits, prompt)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%sCommitted edits to %s on %s (%s)", started, strings.Join(editPaths(edits), ", "), c.task.Branch.Short(), hash.String()[:8]), nil
+}
+
 // Getters
 func (c *Core) GetStack() *MessageStack {
 	c.mu.Lock()
@@ -136,10 +1102,29 @@ func (c *Core) GetActiveFiles() []*FileNode {
 	return c.activeFiles
 }
 
+func (c *Core) GetContextSources() []*ContextSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.contextSources
+}
+
+// GetActiveAIAgents returns copies of the active agent nodes, so requests
+// keep the definitions they started with while the AI Agents tree changes.
 func (c *Core) GetActiveAIAgents() []*AIAgentNode {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.activeAIAgents
+	active := make([]*AIAgentNode, len(c.activeAIAgents))
+	for i, node := range c.activeAIAgents {
+		active[i] = &AIAgentNode{Name: node.Name, AIAgent: node.AIAgent, Active: true}
+	}
+	return active
+}
+
+// SetNodeAgent points an agent node at a reloaded definition.
+func (c *Core) SetNodeAgent(node *AIAgentNode, agent *AIAgent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node.AIAgent = agent
 }
 
 func (c *Core) GetBackendServices() map[string]*Service {
@@ -154,6 +1139,148 @@ func (c *Core) GetCommitMessage() string {
 	return c.commitMessage
 }
 
+func (c *Core) GetCommitAgentName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.commitAgentName
+}
+
+func (c *Core) GetSession() *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// applyParamOverrides gives agents the parameters edited in AI Agents; the caller holds mu.
+func (c *Core) applyParamOverrides() {
+	overrides, err := loadParamOverrides(c.projectDir)
+	if err != nil {
+		log.Printf("Error loading agent parameters: %v", err)
+		return
+	}
+	for _, agent := range getAIAgents() {
+		if params, ok := overrides[agent.Name]; ok {
+			agent.Params = params
+		}
+	}
+}
+
+// SetAgentParams replaces an agent's parameters and keeps them across
+// restarts; nil params go back to those in the agent's file.
+func (c *Core) SetAgentParams(name string, params *GenerationParams) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	overrides, err := loadParamOverrides(c.projectDir)
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		delete(overrides, name)
+	} else {
+		overrides[name] = *params
+	}
+	if err := saveParamOverrides(c.projectDir, overrides); err != nil {
+		return err
+	}
+	c.reloadAgents()
+	return nil
+}
+
+// GetRequestParams returns the parameters set for the next prompt.
+func (c *Core) GetRequestParams() GenerationParams {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requestParams
+}
+
+// SetRequestParams sets parameters for the next prompt, overriding the agents' own.
+func (c *Core) SetRequestParams(params GenerationParams) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requestParams = params
+}
+
+// GetPlan returns a copy of the session's plan, or nil if there is none.
+func (c *Core) GetPlan() *Plan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session.Plan == nil {
+		return nil
+	}
+	plan := *c.session.Plan
+	plan.Steps = append([]PlanStep(nil), plan.Steps...)
+	return &plan
+}
+
+// EditPlan changes the session's plan under the lock and saves the session.
+// The plan can't be edited while one of its steps is running.
+func (c *Core) EditPlan(edit func(plan *Plan)) error {
+	c.mu.Lock()
+	switch {
+	case c.session.Plan == nil:
+		c.mu.Unlock()
+		return fmt.Errorf("there is no plan")
+	case c.planRunning:
+		c.mu.Unlock()
+		return fmt.Errorf("a step is running, edit the plan once it is answered")
+	}
+	edit(c.session.Plan)
+	c.mu.Unlock()
+
+	if err := c.SaveSession(); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+	return nil
+}
+
+// PlanRunning reports whether a plan step is being carried out.
+func (c *Core) PlanRunning() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.planRunning
+}
+
+// SetPlan replaces the session's plan; nil drops it.
+func (c *Core) SetPlan(plan *Plan) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session.Plan = plan
+}
+
+// GetRouting returns how prompts are routed to agents.
+func (c *Core) GetRouting() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.routing
+}
+
+// SetRouting sets how prompts are routed to agents: routingOff, routingRules or routingModel.
+func (c *Core) SetRouting(routing string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.routing = routing
+}
+
+// GetPipeline returns the selected pipeline, or nil when prompts go to the first active agent.
+func (c *Core) GetPipeline() *Pipeline {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pipeline
+}
+
+// SetPipeline selects the pipeline prompts are sent to; nil turns pipelines off.
+func (c *Core) SetPipeline(pipeline *Pipeline) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pipeline = pipeline
+}
+
+func (c *Core) GetTask() *Task {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.task
+}
+
 func (c *Core) GetUserInput() string {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -179,6 +1306,24 @@ func (c *Core) RemoveActiveFile(file *FileNode) {
 	// Logic for removing the FileNode from the slice
 }
 
+func (c *Core) AddContextSource(source *ContextSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.contextSources = append(c.contextSources, source)
+}
+
+func (c *Core) RemoveContextSource(source *ContextSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, existing := range c.contextSources {
+		if existing == source {
+			c.contextSources = append(c.contextSources[:i], c.contextSources[i+1:]...)
+			break
+		}
+	}
+}
+
 func (c *Core) AddActiveAIAgent(agent *AIAgentNode) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -224,6 +1369,12 @@ func (c *Core) SetCommitMessage(message string) {
 	c.commitMessage = message
 }
 
+func (c *Core) SetCommitAgentName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commitAgentName = name
+}
+
 func (c *Core) SetUserInput(input string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestGenerateCommitMessageReportsRequestErrors(t *testing.T) {
+	reloadAgents(nil)
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	serveCompletions(t, http.StatusInternalServerError, `{"error":"down"}`)
+	core := &Core{projectDir: dir, commitAgentName: defaultCommitAgent}
+	if _, err := core.GenerateCommitMessage(); err == nil {
+		t.Error("expected the request error")
+	}
+	if core.GetCommitMessage() != "" {
+		t.Errorf("got draft %q after a failed request", core.GetCommitMessage())
+	}
+}
+
+func TestGeneratePullRequestReportsRequestErrors(t *testing.T) {
+	reloadAgents(nil)
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "a.txt", "a\n")
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature"), Create: true}); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "b.txt", "b\n")
+
+	serveCompletions(t, http.StatusInternalServerError, `{"error":"down"}`)
+	core := &Core{projectDir: dir}
+	if _, err := core.GeneratePullRequest("master"); err == nil {
+		t.Error("expected the request error")
+	}
+}
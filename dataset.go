@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory, relative to the project, where datasets are written by default
+const datasetsDir = ".pixelheat/datasets"
+
+// Epochs used for cost estimates unless told otherwise
+const defaultTrainingEpochs = 3
+
+// Fine-tuning jobs are rejected with fewer examples than this
+const minDatasetExamples = 10
+
+// DatasetOptions selects what goes into a fine-tuning dataset.
+type DatasetOptions struct {
+	PerTurn   bool   // One example per answer instead of one per conversation
+	GoodOnly  bool   // Only answers rated good; otherwise every answer not rated bad
+	Agent     string // Only answers from this agent; empty for every agent
+	Epochs    int
+	Directive func(agent string) string // System directive of an agent; nil or "" leaves it out
+}
+
+// datasetMessage is a message in the chat fine-tuning format. Weight 0
+// keeps an answer as context without training on it.
+type datasetMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	Weight  *int   `json:"weight,omitempty"`
+}
+
+// DatasetExample is one line of a chat fine-tuning JSONL file.
+type DatasetExample struct {
+	Messages []datasetMessage `json:"messages"`
+	Source   string           `json:"-"` // Session, and answer when built per turn
+}
+
+// Tokens estimates the example's size the same way requests are estimated.
+func (e DatasetExample) Tokens() int {
+	total := 0
+	for _, msg := range e.Messages {
+		total += len(msg.Content) / 4
+	}
+	return total
+}
+
+// DatasetReport summarises a built dataset.
+type DatasetReport struct {
+	Path     string
+	Examples int
+	Tokens   int
+	Epochs   int
+	Problems []string
+}
+
+// Costs estimates the training cost of the dataset on each fine-tuning model.
+func (r DatasetReport) Costs() map[string]float64 {
+	costs := make(map[string]float64)
+	for _, model := range models {
+		for _, service := range model.Services {
+			if service.TrainingCost > 0 {
+				costs[service.ModelName] = float64(r.Tokens) / 1000 * service.TrainingCost * float64(r.Epochs)
+			}
+		}
+	}
+	return costs
+}
+
+// String describes the dataset, its estimated cost and any problems found.
+func (r DatasetReport) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Wrote %d example(s), about %d tokens, to %s\n", r.Examples, r.Tokens, r.Path))
+	var estimates []string
+	costs := r.Costs()
+	for _, model := range models {
+		for _, service := range model.Services {
+			if cost, ok := costs[service.ModelName]; ok {
+				estimates = append(estimates, fmt.Sprintf("%s $%.4f", service.ModelName, cost))
+			}
+		}
+	}
+	sb.WriteString(fmt.Sprintf("Estimated training cost for %d epoch(s): %s", r.Epochs, strings.Join(estimates, ", ")))
+	if r.Examples < minDatasetExamples {
+		sb.WriteString(fmt.Sprintf("\nFine-tuning needs at least %d examples", minDatasetExamples))
+	}
+	for _, problem := range r.Problems {
+		sb.WriteString("\nSkipped " + problem)
+	}
+	return sb.String()
+}
+
+// datasetMessages converts a branch of messages, ending with an answer, to the
+// fine-tuning format, starting with directive when there is one. System
+// messages are left out: sessions only keep the files and context attached
+// to the last request, so they don't show what earlier answers were given.
+// Answers that were not selected get weight 0.
+func datasetMessages(branch []Message, directive string, selected func(Message) bool) []datasetMessage {
+	var messages []datasetMessage
+	if directive != "" {
+		messages = append(messages, datasetMessage{Role: "system", Content: directive})
+	}
+	for _, msg := range branch {
+		if msg.Role == "system" {
+			continue
+		}
+		converted := datasetMessage{Role: msg.Role, Content: msg.Content}
+		if msg.Role == "assistant" && !selected(msg) {
+			weight := 0
+			converted.Weight = &weight
+		}
+		messages = append(messages, converted)
+	}
+	return messages
+}
+
+// datasetDirective returns the directives of the loaded agents, for DatasetOptions.
+func datasetDirective(projectDir string) func(string) string {
+	return func(name string) string {
+		agent := findAIAgent(name)
+		if agent == nil {
+			return ""
+		}
+		return renderDirective(agent.Name, agent.Directive, func() DirectiveData {
+			return projectDirectiveData(projectDir, nil)
+		})
+	}
+}
+
+// buildDataset turns the current branch of each session into training examples.
+func buildDataset(sessions []*Session, options DatasetOptions) []DatasetExample {
+	selected := func(msg Message) bool {
+		if options.Agent != "" && msg.Agent != options.Agent {
+			return false
+		}
+		if options.GoodOnly {
+			return msg.Rating == "good"
+		}
+		return msg.Rating != "bad"
+	}
+	directive := func(agent string) string {
+		if options.Directive == nil || agent == "" {
+			return ""
+		}
+		return options.Directive(agent)
+	}
+
+	var examples []DatasetExample
+	for _, session := range sessions {
+		branch := sessionBranch(session)
+		if options.PerTurn {
+			for i, msg := range branch {
+				if msg.Role == "assistant" && selected(msg) {
+					// Earlier answers are context only, the example trains on this one
+					examples = append(examples, DatasetExample{
+						Messages: datasetMessages(branch[:i+1], directive(msg.Agent), func(other Message) bool { return other.ID == msg.ID }),
+						Source:   fmt.Sprintf("%s answer %s", session.Name, msg.ID),
+					})
+				}
+			}
+			continue
+		}
+
+		// Drop trailing messages that have no answer to learn from
+		last := len(branch) - 1
+		for last >= 0 && branch[last].Role != "assistant" {
+			last--
+		}
+		// The directive is the one of the last answer trained on
+		agent := ""
+		for i := last; i >= 0 && agent == ""; i-- {
+			if branch[i].Role == "assistant" && selected(branch[i]) {
+				agent = branch[i].Agent
+			}
+		}
+		examples = append(examples, DatasetExample{
+			Messages: datasetMessages(branch[:last+1], directive(agent), selected),
+			Source:   session.Name,
+		})
+	}
+	return examples
+}
+
+// validateExample checks an example against the chat fine-tuning format.
+func validateExample(example DatasetExample) error {
+	if len(example.Messages) == 0 {
+		return fmt.Errorf("no messages")
+	}
+
+	trained := false
+	for i, msg := range example.Messages {
+		switch msg.Role {
+		case "system", "user", "assistant":
+		default:
+			return fmt.Errorf("message %d has unsupported role %q", i+1, msg.Role)
+		}
+		if strings.TrimSpace(msg.Content) == "" {
+			return fmt.Errorf("message %d is empty", i+1)
+		}
+		if msg.Weight != nil {
+			if msg.Role != "assistant" {
+				return fmt.Errorf("message %d is weighted but is not an answer", i+1)
+			}
+			if *msg.Weight != 0 && *msg.Weight != 1 {
+				return fmt.Errorf("message %d has weight %d, only 0 and 1 are allowed", i+1, *msg.Weight)
+			}
+		}
+		if msg.Role == "assistant" && (msg.Weight == nil || *msg.Weight == 1) {
+			trained = true
+		}
+	}
+	if !trained {
+		return fmt.Errorf("no answer to train on")
+	}
+	return nil
+}
+
+// writeDataset validates the examples and writes the valid ones as JSONL.
+func writeDataset(sessions []*Session, options DatasetOptions, path string) (DatasetReport, error) {
+	if options.Epochs <= 0 {
+		options.Epochs = defaultTrainingEpochs
+	}
+	report := DatasetReport{Path: path, Epochs: options.Epochs}
+
+	var sb strings.Builder
+	for _, example := range buildDataset(sessions, options) {
+		if err := validateExample(example); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s: %v", example.Source, err))
+			continue
+		}
+		line, err := json.Marshal(example)
+		if err != nil {
+			return report, err
+		}
+		sb.Write(line)
+		sb.WriteString("\n")
+		report.Examples++
+		report.Tokens += example.Tokens()
+	}
+	if report.Examples == 0 {
+		return report, fmt.Errorf("no usable examples in the selected sessions")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return report, err
+	}
+	return report, os.WriteFile(path, []byte(sb.String()), 0644)
+}
+
+// datasetPath returns the default file a new dataset is written to.
+func datasetPath(projectDir string) string {
+	return filepath.Join(projectDir, datasetsDir, time.Now().Format("20060102-150405")+".jsonl")
+}
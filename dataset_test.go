@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// linearSession returns a session whose messages follow each other.
+func linearSession(name string, messages ...Message) *Session {
+	session := &Session{ID: name, Name: name}
+	for i, msg := range messages {
+		msg.ID = fmt.Sprintf("%s-%d", name, i)
+		if i > 0 {
+			msg.ParentID = session.Messages[i-1].ID
+		}
+		session.Messages = append(session.Messages, msg)
+		session.Head = msg.ID
+	}
+	return session
+}
+
+// describeExample writes an example as "role:content" items, marking
+// answers kept only as context with (0).
+func describeExample(example DatasetExample) string {
+	var parts []string
+	for _, msg := range example.Messages {
+		part := msg.Role + ":" + msg.Content
+		if msg.Weight != nil && *msg.Weight == 0 {
+			part += "(0)"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " | ")
+}
+
+func TestBuildDataset(t *testing.T) {
+	session := linearSession("s",
+		Message{Role: "user", Content: "q1", Agent: "Coder"},
+		Message{Role: "assistant", Content: "a1", Agent: "Coder", Rating: "good"},
+		Message{Role: "user", Content: "q2", Agent: "Writer"},
+		Message{Role: "system", Content: "directive of Writer"},
+		Message{Role: "system", Content: "File: main.go\nContent:\npackage main"},
+		Message{Role: "assistant", Content: "a2", Agent: "Writer"},
+		Message{Role: "user", Content: "q3", Agent: "Coder"},
+		Message{Role: "assistant", Content: "a3", Agent: "Coder", Rating: "bad"},
+	)
+	directive := func(agent string) string { return "you are " + agent }
+
+	tests := []struct {
+		name     string
+		options  DatasetOptions
+		examples []string
+	}{
+		{"whole conversation", DatasetOptions{Directive: directive}, []string{
+			"system:you are Writer | user:q1 | assistant:a1 | user:q2 | assistant:a2 | user:q3 | assistant:a3(0)",
+		}},
+		{"good only", DatasetOptions{GoodOnly: true, Directive: directive}, []string{
+			"system:you are Coder | user:q1 | assistant:a1 | user:q2 | assistant:a2(0) | user:q3 | assistant:a3(0)",
+		}},
+		{"one agent", DatasetOptions{Agent: "Writer", Directive: directive}, []string{
+			"system:you are Writer | user:q1 | assistant:a1(0) | user:q2 | assistant:a2 | user:q3 | assistant:a3(0)",
+		}},
+		{"per turn", DatasetOptions{PerTurn: true, Directive: directive}, []string{
+			"system:you are Coder | user:q1 | assistant:a1",
+			"system:you are Writer | user:q1 | assistant:a1(0) | user:q2 | assistant:a2",
+		}},
+		{"per turn for one agent", DatasetOptions{PerTurn: true, Agent: "Coder"}, []string{
+			"user:q1 | assistant:a1",
+		}},
+		{"no directives", DatasetOptions{PerTurn: true, GoodOnly: true}, []string{
+			"user:q1 | assistant:a1",
+		}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, example := range buildDataset([]*Session{session}, tt.options) {
+			got = append(got, describeExample(example))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.examples, "\n") {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.examples, "\n"))
+		}
+	}
+}
+
+func TestBuildDatasetWithoutAnswers(t *testing.T) {
+	sessions := []*Session{
+		linearSession("empty"),
+		linearSession("unanswered", Message{Role: "user", Content: "q"}),
+		linearSession("all bad", Message{Role: "user", Content: "q"}, Message{Role: "assistant", Content: "a", Rating: "bad"}),
+	}
+	examples := buildDataset(sessions, DatasetOptions{})
+	want := []string{"no messages", "no messages", "no answer to train on"}
+	if len(examples) != len(want) {
+		t.Fatalf("got %d examples, want %d", len(examples), len(want))
+	}
+	for i, example := range examples {
+		if err := validateExample(example); err == nil || err.Error() != want[i] {
+			t.Errorf("%s: got %v, want %q", example.Source, err, want[i])
+		}
+	}
+	if examples := buildDataset(sessions, DatasetOptions{PerTurn: true}); len(examples) != 0 {
+		t.Errorf("per turn got %d examples, want none", len(examples))
+	}
+}
+
+func TestValidateExample(t *testing.T) {
+	zero, one, two := 0, 1, 2
+	tests := []struct {
+		name     string
+		messages []datasetMessage
+		err      string
+	}{
+		{"valid", []datasetMessage{{Role: "user", Content: "q"}, {Role: "assistant", Content: "a"}}, ""},
+		{"weighted", []datasetMessage{{Role: "user", Content: "q"}, {Role: "assistant", Content: "a", Weight: &one}}, ""},
+		{"no messages", nil, "no messages"},
+		{"bad role", []datasetMessage{{Role: "tool", Content: "x"}}, `message 1 has unsupported role "tool"`},
+		{"empty content", []datasetMessage{{Role: "user", Content: " "}}, "message 1 is empty"},
+		{"weighted question", []datasetMessage{{Role: "user", Content: "q", Weight: &zero}}, "message 1 is weighted but is not an answer"},
+		{"bad weight", []datasetMessage{{Role: "user", Content: "q"}, {Role: "assistant", Content: "a", Weight: &two}}, "message 2 has weight 2, only 0 and 1 are allowed"},
+		{"nothing trained", []datasetMessage{{Role: "user", Content: "q"}, {Role: "assistant", Content: "a", Weight: &zero}}, "no answer to train on"},
+	}
+
+	for _, tt := range tests {
+		err := validateExample(DatasetExample{Messages: tt.messages})
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.err {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.err)
+		}
+	}
+}
+
+func TestWriteDataset(t *testing.T) {
+	sessions := []*Session{
+		linearSession("good", Message{Role: "user", Content: "q"}, Message{Role: "assistant", Content: "a", Agent: "Coder"}),
+		linearSession("empty"),
+	}
+	path := filepath.Join(t.TempDir(), "data", "set.jsonl")
+	report, err := writeDataset(sessions, DatasetOptions{Directive: func(string) string { return "d" }}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Examples != 1 || report.Epochs != defaultTrainingEpochs || len(report.Problems) != 1 {
+		t.Errorf("got report %+v", report)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"messages":[{"role":"system","content":"d"},{"role":"user","content":"q"},{"role":"assistant","content":"a"}]}` + "\n"
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &line); err != nil || len(line) != 1 {
+		t.Errorf("each line should be a JSON object with only messages, got %v (%v)", line, err)
+	}
+
+	if _, err := writeDataset(sessions[1:], DatasetOptions{}, path); err == nil {
+		t.Error("expected an error without usable examples")
+	}
+}
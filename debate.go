@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rounds of proposal and critique unless the user asks for another number
+const defaultDebateRounds = 2
+
+// Most rounds a debate can run
+const maxDebateRounds = 5
+
+// Agent that summarises when fewer than three agents are active
+const defaultSummariser = "Chat Assistant (smart)"
+
+// Debate has one agent propose, another critique, for a number of rounds,
+// before a third summarises a recommendation.
+type Debate struct {
+	Question   string
+	Rounds     int
+	Proposer   *AIAgent
+	Critic     *AIAgent
+	Summariser *AIAgent
+}
+
+// DebateRound is the cost of one round, or of the summary when Round is 0.
+type DebateRound struct {
+	Round int
+	Cost  float64
+}
+
+// proposalPrompt asks the proposer for a design, or for a revision after a critique.
+func (d *Debate) proposalPrompt(round int) string {
+	if round == 1 {
+		return fmt.Sprintf("We need to make a design decision. Propose an approach, with the reasons for it and the trade-offs you accept:\n\n%s", d.Question)
+	}
+	return fmt.Sprintf("Revise your proposal to address the critique of %s above. Keep what still holds, change what doesn't, and say which points you disagree with and why.", d.Critic.Name)
+}
+
+// critiquePrompt asks the critic to challenge the latest proposal.
+func (d *Debate) critiquePrompt() string {
+	return fmt.Sprintf("Critique the proposal of %s above against the attached files: point out risks, missing cases, conflicts with the existing code and better alternatives. Be specific, and say what would change your mind.", d.Proposer.Name)
+}
+
+// summaryPrompt asks the summariser for a recommendation.
+func (d *Debate) summaryPrompt() string {
+	return fmt.Sprintf("Summarise the debate above between %s and %s into a recommendation for: %s\n\nGive the decision, the main arguments for and against it, and any open questions.", d.Proposer.Name, d.Critic.Name, d.Question)
+}
+
+// debateReport lists the cost of each round and the total.
+func debateReport(rounds []DebateRound) string {
+	var parts []string
+	total := 0.0
+	for _, round := range rounds {
+		name := fmt.Sprintf("round %d", round.Round)
+		if round.Round == 0 {
+			name = "summary"
+		}
+		parts = append(parts, fmt.Sprintf("%s $%.4f", name, round.Cost))
+		total += round.Cost
+	}
+	return fmt.Sprintf("Debate cost: %s, total $%.4f", strings.Join(parts, ", "), total)
+}
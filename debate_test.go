@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebatePrompts(t *testing.T) {
+	debate := &Debate{
+		Question: "Should sessions be stored in SQLite?",
+		Rounds:   2,
+		Proposer: &AIAgent{Name: "Architect"},
+		Critic:   &AIAgent{Name: "Skeptic"},
+	}
+
+	tests := []struct {
+		name   string
+		prompt string
+		want   []string
+		not    []string
+	}{
+		{"first proposal", debate.proposalPrompt(1), []string{"Propose an approach", debate.Question}, []string{"Skeptic"}},
+		{"revised proposal", debate.proposalPrompt(2), []string{"Revise your proposal", "critique of Skeptic"}, []string{debate.Question}},
+		{"critique", debate.critiquePrompt(), []string{"Critique the proposal of Architect"}, nil},
+		{"summary", debate.summaryPrompt(), []string{"between Architect and Skeptic", debate.Question}, nil},
+	}
+
+	for _, tt := range tests {
+		for _, want := range tt.want {
+			if !strings.Contains(tt.prompt, want) {
+				t.Errorf("%s: %q does not contain %q", tt.name, tt.prompt, want)
+			}
+		}
+		for _, not := range tt.not {
+			if strings.Contains(tt.prompt, not) {
+				t.Errorf("%s: %q should not contain %q", tt.name, tt.prompt, not)
+			}
+		}
+	}
+}
+
+func TestDebateReport(t *testing.T) {
+	tests := []struct {
+		rounds []DebateRound
+		want   string
+	}{
+		{nil, "Debate cost: , total $0.0000"},
+		{[]DebateRound{{Round: 0, Cost: 0.5}}, "Debate cost: summary $0.5000, total $0.5000"},
+		{[]DebateRound{{Round: 1, Cost: 0.01}, {Round: 2, Cost: 0.02}, {Round: 0, Cost: 0.005}}, "Debate cost: round 1 $0.0100, round 2 $0.0200, summary $0.0050, total $0.0350"},
+	}
+
+	for _, tt := range tests {
+		if got := debateReport(tt.rounds); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNewDebate(t *testing.T) {
+	reloadAgents(nil)
+	defer reloadAgents(nil)
+	node := func(name string) *AIAgentNode {
+		return &AIAgentNode{Name: name, AIAgent: &AIAgent{Name: name}, Active: true}
+	}
+
+	tests := []struct {
+		name       string
+		active     []*AIAgentNode
+		rounds     int
+		summariser string
+		err        string
+	}{
+		{"one agent", []*AIAgentNode{node("A")}, 2, "", "select a proposer and a critic"},
+		{"no rounds", []*AIAgentNode{node("A"), node("B")}, 0, "", "use 1 to 5 rounds"},
+		{"too many rounds", []*AIAgentNode{node("A"), node("B")}, maxDebateRounds + 1, "", "use 1 to 5 rounds"},
+		{"third agent summarises", []*AIAgentNode{node("A"), node("B"), node("C")}, 1, "C", ""},
+		{"default summariser", []*AIAgentNode{node("A"), node("B")}, maxDebateRounds, defaultSummariser, ""},
+	}
+
+	for _, tt := range tests {
+		core := &Core{activeAIAgents: tt.active}
+		debate, err := core.NewDebate("question", tt.rounds)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if debate.Proposer.Name != "A" || debate.Critic.Name != "B" || debate.Summariser.Name != tt.summariser || debate.Rounds != tt.rounds {
+			t.Errorf("%s: got %s, %s and %s for %d rounds", tt.name, debate.Proposer.Name, debate.Critic.Name, debate.Summariser.Name, debate.Rounds)
+		}
+	}
+
+	// Without the default summariser loaded a third agent is needed
+	agentsMu.Lock()
+	aiAgents = nil
+	agentsMu.Unlock()
+	core := &Core{activeAIAgents: []*AIAgentNode{node("A"), node("B")}}
+	if _, err := core.NewDebate("question", 1); err == nil || !strings.Contains(err.Error(), "select a third agent") {
+		t.Errorf("got error %v, want a request for a summariser", err)
+	}
+}
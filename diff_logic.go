@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Number of unchanged lines shown around each change in a hunk
+const diffContextLines = 3
+
+// diffChange is a single run of removed and/or inserted lines.
+type diffChange struct {
+	OldStart int      // Index of the first replaced line in the old content
+	OldLines []string // Lines removed from the old content
+	NewLines []string // Lines inserted in their place
+}
+
+// diffHunk groups nearby changes together with their surrounding context.
+type diffHunk struct {
+	OldStart int      // 1-based first line of the hunk in the old content
+	OldCount int      // Number of old lines covered by the hunk
+	NewStart int      // 1-based first line of the hunk in the new content
+	NewCount int      // Number of new lines covered by the hunk
+	Lines    []string // Unified diff lines prefixed with ' ', '-' or '+'
+	changes  []diffChange
+}
+
+// Header returns the "@@ -a,b +c,d @@" line for the hunk.
+func (h *diffHunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldCount, h.NewStart, h.NewCount)
+}
+
+// String returns the hunk in unified diff format.
+func (h *diffHunk) String() string {
+	return h.Header() + "\n" + strings.Join(h.Lines, "\n") + "\n"
+}
+
+// splitLines splits content into lines, keeping the line terminators.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the changes needed to turn old into new.
+func diffLines(old, new string) []diffChange {
+	var changes []diffChange
+	var current *diffChange
+	oldIndex := 0
+
+	flush := func() {
+		if current != nil {
+			changes = append(changes, *current)
+			current = nil
+		}
+	}
+
+	for _, d := range diff.Do(old, new) {
+		lines := splitLines(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			flush()
+			oldIndex += len(lines)
+		case diffmatchpatch.DiffDelete:
+			if current == nil {
+				current = &diffChange{OldStart: oldIndex}
+			}
+			current.OldLines = append(current.OldLines, lines...)
+			oldIndex += len(lines)
+		case diffmatchpatch.DiffInsert:
+			if current == nil {
+				current = &diffChange{OldStart: oldIndex}
+			}
+			current.NewLines = append(current.NewLines, lines...)
+		}
+	}
+	flush()
+
+	return changes
+}
+
+// diffHunks groups the changes between old and new into unified diff hunks.
+func diffHunks(old, new string) []diffHunk {
+	oldLines := splitLines(old)
+	changes := diffLines(old, new)
+
+	var hunks []diffHunk
+	offset := 0 // Difference between new and old line numbers before the current hunk
+	for i := 0; i < len(changes); {
+		// Collect changes that are close enough to share context
+		j := i + 1
+		for j < len(changes) {
+			prevEnd := changes[j-1].OldStart + len(changes[j-1].OldLines)
+			if changes[j].OldStart-prevEnd > 2*diffContextLines {
+				break
+			}
+			j++
+		}
+		group := changes[i:j]
+
+		start := group[0].OldStart - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		last := group[len(group)-1]
+		end := last.OldStart + len(last.OldLines) + diffContextLines
+		if end > len(oldLines) {
+			end = len(oldLines)
+		}
+
+		hunk := diffHunk{changes: group}
+		pos := start
+		delta := 0
+		for _, c := range group {
+			for _, line := range oldLines[pos:c.OldStart] {
+				hunk.Lines = append(hunk.Lines, " "+displayLine(line))
+			}
+			for _, line := range c.OldLines {
+				hunk.Lines = append(hunk.Lines, "-"+displayLine(line))
+			}
+			for _, line := range c.NewLines {
+				hunk.Lines = append(hunk.Lines, "+"+displayLine(line))
+			}
+			pos = c.OldStart + len(c.OldLines)
+			delta += len(c.NewLines) - len(c.OldLines)
+		}
+		for _, line := range oldLines[pos:end] {
+			hunk.Lines = append(hunk.Lines, " "+displayLine(line))
+		}
+
+		hunk.OldCount = end - start
+		hunk.NewCount = hunk.OldCount + delta
+		hunk.OldStart = start
+		hunk.NewStart = start + offset
+		// Unified diffs are 1-based, except for empty ranges
+		if hunk.OldCount > 0 {
+			hunk.OldStart++
+		}
+		if hunk.NewCount > 0 {
+			hunk.NewStart++
+		}
+
+		hunks = append(hunks, hunk)
+		offset += delta
+		i = j
+	}
+
+	return hunks
+}
+
+// displayLine strips the terminator from a line, marking a missing final newline.
+func displayLine(line string) string {
+	if strings.HasSuffix(line, "\n") {
+		return strings.TrimSuffix(line, "\n")
+	}
+	return line + "\n\\ No newline at end of file"
+}
+
+// applyHunks applies the selected hunks of a diff made against old and returns the result.
+func applyHunks(old string, hunks []diffHunk, selected func(int) bool) string {
+	oldLines := splitLines(old)
+
+	var result strings.Builder
+	pos := 0
+	for i, hunk := range hunks {
+		if !selected(i) {
+			continue
+		}
+		for _, c := range hunk.changes {
+			result.WriteString(strings.Join(oldLines[pos:c.OldStart], ""))
+			result.WriteString(strings.Join(c.NewLines, ""))
+			pos = c.OldStart + len(c.OldLines)
+		}
+	}
+	result.WriteString(strings.Join(oldLines[pos:], ""))
+
+	return result.String()
+}
+
+// unifiedDiff renders the changes to a single file in unified diff format.
+func unifiedDiff(path, old, new string, oldExists, newExists bool) string {
+	hunks := diffHunks(old, new)
+	if len(hunks) == 0 && oldExists == newExists {
+		return ""
+	}
+
+	from, to := "a/"+path, "b/"+path
+	if !oldExists {
+		from = "/dev/null"
+	}
+	if !newExists {
+		to = "/dev/null"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n--- %s\n+++ %s\n", path, path, from, to))
+	for _, hunk := range hunks {
+		sb.WriteString(hunk.String())
+	}
+	return sb.String()
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// numberDiffLines prefixes the context and added lines of a unified diff with
+// their line number in the new file, so reviewers can refer to them.
+func numberDiffLines(patch string) string {
+	var sb strings.Builder
+	line := 0
+	inHunk := false
+	for _, text := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		if match := hunkHeader.FindStringSubmatch(text); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			inHunk = true
+			sb.WriteString(text + "\n")
+			continue
+		}
+		if strings.HasPrefix(text, "diff --git") {
+			inHunk = false
+		}
+		if !inHunk {
+			sb.WriteString(text + "\n")
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "+"), strings.HasPrefix(text, " "):
+			sb.WriteString(fmt.Sprintf("%5d %s\n", line, text))
+			line++
+		default:
+			sb.WriteString(fmt.Sprintf("%5s %s\n", "", text))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numbered returns n lines "line 1".."line n", with some replaced.
+func numbered(n int, replace map[int]string) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		if line, ok := replace[i]; ok {
+			sb.WriteString(line)
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("line %d\n", i))
+	}
+	return sb.String()
+}
+
+func TestDiffHunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		headers []string
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", nil},
+		{"added file", "", "a\nb\n", []string{"@@ -0,0 +1,2 @@"}},
+		{"deleted file", "a\nb\n", "", []string{"@@ -1,2 +0,0 @@"}},
+		{"one change", "a\nb\nc\n", "a\nB\nc\n", []string{"@@ -1,3 +1,3 @@"}},
+		{"nearby changes share a hunk", numbered(20, nil), numbered(20, map[int]string{5: "five\n", 10: "ten\n"}), []string{"@@ -2,12 +2,12 @@"}},
+		{"distant changes split", numbered(30, nil), numbered(30, map[int]string{2: "two\n", 25: "25\n"}), []string{"@@ -1,5 +1,5 @@", "@@ -22,7 +22,7 @@"}},
+		{"insertion shifts later hunks", numbered(30, nil), numbered(30, map[int]string{2: "two\nextra\n", 25: "25\n"}), []string{"@@ -1,5 +1,6 @@", "@@ -22,7 +23,7 @@"}},
+	}
+
+	for _, tt := range tests {
+		hunks := diffHunks(tt.old, tt.new)
+		var headers []string
+		for _, hunk := range hunks {
+			headers = append(headers, hunk.Header())
+		}
+		if strings.Join(headers, " ") != strings.Join(tt.headers, " ") {
+			t.Errorf("%s: got hunks %q, want %q", tt.name, headers, tt.headers)
+		}
+	}
+}
+
+func TestDiffHunksMissingNewline(t *testing.T) {
+	hunks := diffHunks("a\nb", "a\nb\n")
+	if len(hunks) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(hunks))
+	}
+	want := "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"
+	if got := hunks[0].String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	old := numbered(30, nil)
+	new := numbered(30, map[int]string{2: "two\nextra\n", 25: ""})
+	hunks := diffHunks(old, new)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(hunks))
+	}
+
+	tests := []struct {
+		name     string
+		selected func(int) bool
+		want     string
+	}{
+		{"none", func(int) bool { return false }, old},
+		{"all", func(int) bool { return true }, new},
+		{"first", func(i int) bool { return i == 0 }, numbered(30, map[int]string{2: "two\nextra\n"})},
+		{"second", func(i int) bool { return i == 1 }, numbered(30, map[int]string{25: ""})},
+	}
+	for _, tt := range tests {
+		if got := applyHunks(old, hunks, tt.selected); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNumberDiffLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{
+			"added and removed lines",
+			"diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -3,3 +3,3 @@ func main() {\n keep\n-old\n+new\n keep\n",
+			"diff --git a/a.go b/a.go\n--- a/a.go\n+++ b/a.go\n@@ -3,3 +3,3 @@ func main() {\n    3  keep\n      -old\n    4 +new\n    5  keep\n",
+		},
+		{
+			"header without counts",
+			"@@ -1 +1 @@\n-a\n+b\n",
+			"@@ -1 +1 @@\n      -a\n    1 +b\n",
+		},
+		{
+			"missing newline marker",
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+			"@@ -1,2 +1,2 @@\n    1  a\n      -b\n      \\ No newline at end of file\n    2 +b\n",
+		},
+		{
+			"second hunk restarts the numbering",
+			"@@ -1,1 +1,2 @@\n a\n+b\n@@ -20,1 +21,1 @@\n-c\n+d\n",
+			"@@ -1,1 +1,2 @@\n    1  a\n    2 +b\n@@ -20,1 +21,1 @@\n      -c\n   21 +d\n",
+		},
+		{
+			"file headers of the next file stay unnumbered",
+			"@@ -1 +1 @@\n+a\ndiff --git a/b b/b\nnew file mode 100644\n--- /dev/null\n+++ b/b\n@@ -0,0 +1 @@\n+b\n",
+			"@@ -1 +1 @@\n    1 +a\ndiff --git a/b b/b\nnew file mode 100644\n--- /dev/null\n+++ b/b\n@@ -0,0 +1 @@\n    1 +b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := numberDiffLines(tt.patch); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
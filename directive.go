@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Lines of the README given to directives as .Readme
+const readmeExcerptLines = 30
+
+// Languages listed in .Languages
+const maxDirectiveLanguages = 5
+
+// directiveFuncs are the functions directive templates can use besides the builtins.
+var directiveFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"lines": func(n int, text string) string {
+		return excerptLines(text, n)
+	},
+}
+
+// DirectiveData is what a directive template can refer to, for example
+// "You are working on {{.Project}}, on the {{.Branch}} branch".
+type DirectiveData struct {
+	Project   string   // Name of the project directory
+	Branch    string   // Current git branch, empty when HEAD is detached or there is no repository
+	Languages string   // Language mix of the files in HEAD, like "Go 80%, Markdown 20%"
+	Date      string   // Today, as YYYY-MM-DD
+	Files     []string // Files attached to the request
+	Readme    string   // The start of the project's README
+}
+
+// parseDirective checks a directive for template errors.
+func parseDirective(name, directive string) (*template.Template, error) {
+	return template.New(name).Funcs(directiveFuncs).Option("missingkey=error").Parse(directive)
+}
+
+// renderDirective fills in a directive's variables. Directives without any
+// are returned as they are, so no project data is gathered for them.
+func renderDirective(name, directive string, data func() DirectiveData) string {
+	if !strings.Contains(directive, "{{") {
+		return directive
+	}
+	tmpl, err := parseDirective(name, directive)
+	if err != nil {
+		log.Printf("Error parsing directive of %s: %v", name, err)
+		return directive
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data()); err != nil {
+		log.Printf("Error rendering directive of %s: %v", name, err)
+		return directive
+	}
+	return sb.String()
+}
+
+// projectDirectiveData gathers the template variables for a project.
+func projectDirectiveData(dir string, files []string) DirectiveData {
+	data := DirectiveData{
+		Date:  time.Now().Format("2006-01-02"),
+		Files: files,
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		data.Project = filepath.Base(abs)
+	}
+	data.Readme = excerptLines(ReadmeContent(listFiles(dir)), readmeExcerptLines)
+
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return data
+	}
+	if head, err := r.Head(); err == nil && head.Name().IsBranch() {
+		data.Branch = head.Name().Short()
+	}
+	languages, err := languageMix(r)
+	if err != nil {
+		log.Printf("Error computing language mix: %v", err)
+	}
+	data.Languages = languages
+	return data
+}
+
+// excerptLines returns the first n lines of text.
+func excerptLines(text string, n int) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) > n {
+		lines = append(lines[:n], "...")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The language mix only changes with HEAD, so it is kept for the last commit seen
+var (
+	languageMixMu     sync.Mutex
+	languageMixCommit plumbing.Hash
+	languageMixText   string
+)
+
+// languageMix describes the languages of the files in HEAD by their share of bytes.
+func languageMix(r *git.Repository) (string, error) {
+	commit, err := headCommit(r)
+	if err != nil || commit == nil {
+		return "", err
+	}
+
+	languageMixMu.Lock()
+	defer languageMixMu.Unlock()
+	if commit.Hash == languageMixCommit {
+		return languageMixText, nil
+	}
+
+	sizes := make(map[string]int64)
+	var total int64
+	files, err := commit.Files()
+	if err != nil {
+		return "", err
+	}
+	err = files.ForEach(func(file *object.File) error {
+		language := fileLanguage(file.Name)
+		if language == "" {
+			return nil
+		}
+		sizes[language] += file.Size
+		total += file.Size
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var languages []string
+	for language := range sizes {
+		languages = append(languages, language)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		return sizes[languages[i]] > sizes[languages[j]]
+	})
+	if len(languages) > maxDirectiveLanguages {
+		languages = languages[:maxDirectiveLanguages]
+	}
+
+	var parts []string
+	for _, language := range languages {
+		if percent := sizes[language] * 100 / total; percent > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d%%", language, percent))
+		}
+	}
+	languageMixCommit = commit.Hash
+	languageMixText = strings.Join(parts, ", ")
+	return languageMixText, nil
+}
+
+// languageNames maps file extensions to the languages counted in the language mix.
+var languageNames = map[string]string{
+	".go": "Go", ".py": "Python", ".js": "JavaScript", ".jsx": "JavaScript", ".ts": "TypeScript",
+	".tsx": "TypeScript", ".rs": "Rust", ".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++",
+	".hpp": "C++", ".java": "Java", ".kt": "Kotlin", ".swift": "Swift", ".rb": "Ruby",
+	".php": "PHP", ".cs": "C#", ".sh": "Shell", ".sql": "SQL", ".html": "HTML", ".css": "CSS",
+	".scss": "CSS", ".md": "Markdown", ".yaml": "YAML", ".yml": "YAML", ".json": "JSON",
+	".toml": "TOML", ".lua": "Lua", ".zig": "Zig", ".dart": "Dart", ".scala": "Scala",
+}
+
+// fileLanguage returns the language of a file by its extension, or "" if it isn't counted.
+func fileLanguage(name string) string {
+	return languageNames[strings.ToLower(filepath.Ext(name))]
+}
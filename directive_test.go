@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestRenderDirective(t *testing.T) {
+	data := DirectiveData{
+		Project:   "pixelheat",
+		Branch:    "main",
+		Languages: "Go 90%, Markdown 10%",
+		Date:      "2024-05-01",
+		Files:     []string{"main.go", "core.go"},
+		Readme:    "# PixelHeat\nA chat client\nfor code",
+	}
+
+	tests := []struct {
+		name      string
+		directive string
+		want      string
+	}{
+		{"no variables", "You are helpful.", "You are helpful."},
+		{"variables", "You work on {{.Project}} on {{.Branch}} ({{.Languages}}), today is {{.Date}}.", "You work on pixelheat on main (Go 90%, Markdown 10%), today is 2024-05-01."},
+		{"functions", "{{upper .Project}} {{lower .Branch}} {{join .Files \", \"}}", "PIXELHEAT main main.go, core.go"},
+		{"readme excerpt", "{{lines 2 .Readme}}", "# PixelHeat\nA chat client\n..."},
+		{"conditional", "{{if .Branch}}On {{.Branch}}{{else}}No branch{{end}}", "On main"},
+		{"unknown variable", "Hello {{.Owner}}", "Hello {{.Owner}}"},
+		{"parse error", "Hello {{.Project", "Hello {{.Project"},
+	}
+
+	for _, tt := range tests {
+		if got := renderDirective("Tester", tt.directive, func() DirectiveData { return data }); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderDirectiveWithoutVariablesSkipsProjectData(t *testing.T) {
+	renderDirective("Tester", "Plain text", func() DirectiveData {
+		t.Error("project data gathered for a directive without variables")
+		return DirectiveData{}
+	})
+}
+
+func TestParseDirective(t *testing.T) {
+	tests := []struct {
+		directive string
+		err       bool
+	}{
+		{"{{.Project}}", false},
+		{"{{lines 3 .Readme}}", false},
+		{"{{.Project", true},
+		{"{{nope .Project}}", true},
+		{"{{end}}", true},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseDirective("Tester", tt.directive); (err != nil) != tt.err {
+			t.Errorf("%q: got error %v, want error %v", tt.directive, err, tt.err)
+		}
+	}
+}
+
+func TestProjectDirectiveData(t *testing.T) {
+	// Without a repository only the project, date and files are known
+	dir := t.TempDir()
+	data := projectDirectiveData(dir, []string{"a.go"})
+	if data.Project == "" || data.Date == "" || data.Branch != "" || data.Languages != "" || len(data.Files) != 1 {
+		t.Errorf("got %+v", data)
+	}
+	if got := renderDirective("Tester", "{{.Project}} on {{or .Branch \"no branch\"}}", func() DirectiveData { return data }); !strings.HasSuffix(got, " on no branch") {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := git.PlainInit(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	// An empty repository has no commit yet, so no branch or languages
+	data = projectDirectiveData(dir, nil)
+	if data.Branch != "" || data.Languages != "" {
+		t.Errorf("got %+v for an empty repository", data)
+	}
+
+	commitFile(t, dir, "main.go", strings.Repeat("x", 300))
+	commitFile(t, dir, "README.md", strings.Repeat("x", 100))
+	data = projectDirectiveData(dir, nil)
+	if data.Branch != "master" || data.Languages != "Go 75%, Markdown 25%" {
+		t.Errorf("got branch %q and languages %q", data.Branch, data.Languages)
+	}
+}
+
+func TestExcerptLines(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"a\nb", 3, "a\nb"},
+		{"\na\nb\nc\n", 2, "a\nb\n..."},
+		{"", 1, ""},
+	}
+
+	for _, tt := range tests {
+		if got := excerptLines(tt.text, tt.n); got != tt.want {
+			t.Errorf("excerptLines(%q, %d): got %q, want %q", tt.text, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// editInstructions tells an agent how to format file edits so they can be applied.
+const editInstructions = "When you change a file, reply with its complete new content: a line `File: <path>` followed by a fenced code block containing the whole file. Only use this format for files you want written to disk."
+
+// FileEdit is a full replacement of a file proposed by an agent.
+type FileEdit struct {
+	Path    string
+	Content string
+}
+
+// parseFileEdits extracts "File: <path>" blocks followed by a fenced code block from a response.
+func parseFileEdits(response string) []FileEdit {
+	lines := strings.Split(response, "\n")
+
+	var edits []FileEdit
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(line, "File:") {
+			continue
+		}
+		path := strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "File:")), "`*")
+		if path == "" {
+			continue
+		}
+
+		// The code block must start on the next non-empty line
+		j := i + 1
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+			j++
+		}
+		if j >= len(lines) {
+			break
+		}
+		fence := strings.TrimSpace(lines[j])
+		if !strings.HasPrefix(fence, "```") {
+			continue
+		}
+		fence = fence[:strings.LastIndex(fence, "`")+1]
+
+		var content []string
+		k := j + 1
+		for k < len(lines) && strings.TrimSpace(lines[k]) != fence {
+			content = append(content, lines[k])
+			k++
+		}
+		if k >= len(lines) {
+			break // Unterminated code block
+		}
+
+		edits = append(edits, FileEdit{Path: path, Content: strings.Join(content, "\n") + "\n"})
+		i = k
+	}
+
+	return edits
+}
+
+// editPaths returns the paths touched by a list of edits.
+func editPaths(edits []FileEdit) []string {
+	var paths []string
+	for _, edit := range edits {
+		paths = append(paths, edit.Path)
+	}
+	return paths
+}
+
+// applyFileEdits writes the edits to disk, relative to dir.
+func applyFileEdits(dir string, edits []FileEdit) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, edit := range edits {
+		target := filepath.Join(root, filepath.FromSlash(edit.Path))
+		if !strings.HasPrefix(target, root+string(filepath.Separator)) {
+			return fmt.Errorf("refusing to write %s outside of %s", edit.Path, root)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(target); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.WriteFile(target, []byte(edit.Content), mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
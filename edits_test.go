@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFileEdits(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []FileEdit
+	}{
+		{"none", "Just an explanation.", nil},
+		{"one", "Here:\nFile: main.go\n```go\npackage main\n```\n", []FileEdit{{"main.go", "package main\n"}}},
+		{"decorated path and blank line", "File: **`a/b.txt`**\n\n```\nx\n\ny\n```", []FileEdit{{"a/b.txt", "x\n\ny\n"}}},
+		{"two", "File: a\n```\n1\n```\ntext\nFile: b\n```\n2\n```", []FileEdit{{"a", "1\n"}, {"b", "2\n"}}},
+		{"longer fence keeps inner fences", "File: readme.md\n````md\n```go\nx\n```\n````", []FileEdit{{"readme.md", "```go\nx\n```\n"}}},
+		{"no code block", "File: a\nsome prose\nFile: b\n```\n2\n```", []FileEdit{{"b", "2\n"}}},
+		{"unterminated", "File: a\n```\n1\n", nil},
+		{"empty path", "File:\n```\n1\n```", nil},
+	}
+	for _, tt := range tests {
+		if got := parseFileEdits(tt.response); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
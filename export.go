@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory, relative to the project, where exports are written by default
+const exportsDir = ".pixelheat/exports"
+
+// exportFormats maps each export format to its file extension.
+var exportFormats = map[string]string{
+	"markdown": ".md",
+	"html":     ".html",
+	"jsonl":    ".jsonl",
+}
+
+// exportFormat returns the canonical name of an export format, accepting file extensions too.
+func exportFormat(name string) (string, error) {
+	name = strings.TrimPrefix(strings.ToLower(name), ".")
+	if name == "md" {
+		name = "markdown"
+	}
+	if _, ok := exportFormats[name]; !ok {
+		return "", fmt.Errorf("unknown export format %q, use markdown, html or jsonl", name)
+	}
+	return name, nil
+}
+
+// exportPath returns the default file a session is exported to.
+func exportPath(projectDir string, session *Session, format string) string {
+	return filepath.Join(projectDir, exportsDir, session.ID+exportFormats[format])
+}
+
+// sessionBranch returns the messages of a session's current branch.
+func sessionBranch(session *Session) []Message {
+	stack := &MessageStack{}
+	stack.setTree(append([]Message(nil), session.Messages...), session.Head)
+	return stack.getAllMessages()
+}
+
+// exportSession renders a session in the given format.
+func exportSession(session *Session, format string) (string, error) {
+	switch format {
+	case "markdown":
+		return exportMarkdown(session), nil
+	case "html":
+		return exportHTML(session), nil
+	case "jsonl":
+		return exportJSONL(session)
+	default:
+		return "", fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// writeExport renders a session and writes it to path, creating directories as needed.
+func writeExport(session *Session, format, path string) error {
+	content, err := exportSession(session, format)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// speaker returns the heading used for a message in exports.
+func speaker(msg Message) string {
+	name := "User"
+	var details []string
+	if msg.Role == "assistant" {
+		name = "Assistant"
+		if msg.Agent != "" {
+			name = msg.Agent
+		}
+		if msg.Service != "" {
+			details = append(details, msg.Service)
+		}
+	}
+	if !msg.Time.IsZero() {
+		details = append(details, msg.Time.Format("2006-01-02 15:04"))
+	}
+	if len(details) > 0 {
+		name += " (" + strings.Join(details, ", ") + ")"
+	}
+	return name
+}
+
+// exportMarkdown renders the current branch of a session as Markdown.
+// Message content is already Markdown, so code fences are kept as they are.
+func exportMarkdown(session *Session) string {
+	var sb strings.Builder
+	sb.WriteString("# " + session.Name + "\n\n")
+	sb.WriteString(fmt.Sprintf("_Exported from PixelHeat on %s, total cost $%.4f_\n", time.Now().Format("2006-01-02 15:04"), session.Cost()))
+
+	for _, msg := range sessionBranch(session) {
+		if msg.Role == "system" {
+			continue
+		}
+		sb.WriteString("\n## " + speaker(msg) + "\n\n")
+		sb.WriteString(strings.TrimRight(msg.Content, "\n") + "\n")
+	}
+	return sb.String()
+}
+
+// jsonlTurn is a line of a JSONL export holding a turn rather than a message.
+type jsonlTurn struct {
+	Turn *Turn `json:"turn"`
+}
+
+// exportJSONL writes one message per line so the session can be imported again.
+// The session's turns come first, as {"turn": ...} lines, then messages of
+// other branches and the current branch last, so the final line is the head
+// of the conversation.
+func exportJSONL(session *Session) (string, error) {
+	branch := sessionBranch(session)
+	onBranch := make(map[string]bool)
+	for _, msg := range branch {
+		onBranch[msg.ID] = true
+	}
+
+	var ordered []Message
+	for _, msg := range session.Messages {
+		if !onBranch[msg.ID] {
+			ordered = append(ordered, msg)
+		}
+	}
+	ordered = append(ordered, branch...)
+
+	var sb strings.Builder
+	for i := range session.Turns {
+		line, err := json.Marshal(jsonlTurn{Turn: &session.Turns[i]})
+		if err != nil {
+			return "", err
+		}
+		sb.Write(line)
+		sb.WriteString("\n")
+	}
+	for _, msg := range ordered {
+		line, err := json.Marshal(msg)
+		if err != nil {
+			return "", err
+		}
+		sb.Write(line)
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// importSession reads a JSONL export into a new saved session named after the file.
+func importSession(projectDir, path string) (*Session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var messages []Message
+	var turns []Turn
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024) // Messages can contain whole files
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var turn jsonlTurn
+		if err := json.Unmarshal([]byte(line), &turn); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, number, err)
+		}
+		if turn.Turn != nil {
+			turns = append(turns, *turn.Turn)
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, number, err)
+		}
+		if msg.ID == "" {
+			msg.ID = newMessageID()
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%s contains no messages", path)
+	}
+
+	session := newSession()
+	session.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	session.Messages = messages
+	session.Head = messages[len(messages)-1].ID
+	session.Turns = turns
+	if err := saveSession(projectDir, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// textBlock is a run of prose or a fenced code block within a message.
+type textBlock struct {
+	Code bool
+	Lang string
+	Text string
+}
+
+// splitFences splits Markdown into prose and fenced code blocks.
+// An unterminated fence runs to the end of the text.
+func splitFences(content string) []textBlock {
+	var blocks []textBlock
+	var current []string
+	inCode := false
+	fence, lang := "", ""
+
+	flush := func(code bool) {
+		if len(current) > 0 || code {
+			blocks = append(blocks, textBlock{Code: code, Lang: lang, Text: strings.Join(current, "\n")})
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inCode && strings.HasPrefix(trimmed, "```"):
+			flush(false)
+			fence = trimmed[:strings.LastIndex(trimmed, "`")+1]
+			lang = strings.TrimSpace(trimmed[len(fence):])
+			inCode = true
+		case inCode && trimmed == fence:
+			flush(true)
+			inCode, lang = false, ""
+		default:
+			current = append(current, line)
+		}
+	}
+	flush(inCode)
+	return blocks
+}
+
+// htmlStyle is embedded in exported pages so they need nothing else to display.
+const htmlStyle = `body { font-family: sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; color: #222; }
+.message { border-left: 4px solid #ccc; margin: 1.5em 0; padding: 0 1em; }
+.user { border-color: #4a90d9; }
+.assistant { border-color: #6ab04c; }
+.speaker { font-weight: bold; }
+.meta { color: #888; font-size: 0.85em; }
+pre { background: #1e1e1e; color: #d4d4d4; padding: 1em; overflow-x: auto; border-radius: 4px; }
+.kw { color: #569cd6; } .str { color: #ce9178; } .num { color: #b5cea8; } .com { color: #6a9955; font-style: italic; }`
+
+// exportHTML renders the current branch of a session as a standalone HTML page.
+func exportHTML(session *Session) string {
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	sb.WriteString("<title>" + html.EscapeString(session.Name) + "</title>\n")
+	sb.WriteString("<style>\n" + htmlStyle + "\n</style>\n</head>\n<body>\n")
+	sb.WriteString("<h1>" + html.EscapeString(session.Name) + "</h1>\n")
+	sb.WriteString(fmt.Sprintf("<p class=\"meta\">Exported from PixelHeat on %s, total cost $%.4f</p>\n", time.Now().Format("2006-01-02 15:04"), session.Cost()))
+
+	for _, msg := range sessionBranch(session) {
+		if msg.Role == "system" {
+			continue
+		}
+		sb.WriteString("<div class=\"message " + msg.Role + "\">\n")
+		sb.WriteString("<p class=\"speaker\">" + html.EscapeString(speaker(msg)) + "</p>\n")
+		for _, block := range splitFences(msg.Content) {
+			if block.Code {
+				sb.WriteString("<pre><code>" + highlightCode(block.Text, block.Lang) + "</code></pre>\n")
+				continue
+			}
+			for _, paragraph := range strings.Split(strings.TrimSpace(block.Text), "\n\n") {
+				if paragraph == "" {
+					continue
+				}
+				sb.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>\n") + "</p>\n")
+			}
+		}
+		sb.WriteString("</div>\n")
+	}
+
+	sb.WriteString("</body>\n</html>\n")
+	return sb.String()
+}
+
+// highlightCode escapes code for HTML and wraps keywords, strings, numbers and
+// comments in spans.
+func highlightCode(code, lang string) string {
+	var sb strings.Builder
+	for i, line := range strings.Split(code, "\n") {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		for _, span := range highlightLine(line, lang) {
+			if span.Class == "" {
+				sb.WriteString(html.EscapeString(span.Text))
+				continue
+			}
+			sb.WriteString("<span class=\"" + span.Class + "\">" + html.EscapeString(span.Text) + "</span>")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitFences(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		blocks  []textBlock
+	}{
+		{"prose", "one\ntwo", []textBlock{{Text: "one\ntwo"}}},
+		{"code", "```go\nx := 1\n```", []textBlock{{Code: true, Lang: "go", Text: "x := 1"}}},
+		{"prose around code", "before\n```\ncode\n```\nafter", []textBlock{
+			{Text: "before"}, {Code: true, Text: "code"}, {Text: "after"},
+		}},
+		{"empty code", "```sh\n```", []textBlock{{Code: true, Lang: "sh"}}},
+		{"unterminated", "text\n```py\nprint(1)", []textBlock{{Text: "text"}, {Code: true, Lang: "py", Text: "print(1)"}}},
+		{"longer fence", "````md\n```\ninner\n```\n````", []textBlock{{Code: true, Lang: "md", Text: "```\ninner\n```"}}},
+		{"indented fence", "  ```\n  code\n  ```", []textBlock{{Code: true, Text: "  code"}}},
+	}
+
+	for _, tt := range tests {
+		if got := splitFences(tt.content); !reflect.DeepEqual(got, tt.blocks) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.blocks)
+		}
+	}
+}
+
+func TestExportImportJSONL(t *testing.T) {
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	session := &Session{
+		ID:   "original",
+		Name: "original",
+		Messages: []Message{
+			{ID: "u1", Role: "user", Content: "question", Time: when},
+			{ID: "a1", ParentID: "u1", Role: "assistant", Content: "first", Agent: "Coder", Usage: Usage{InputTokens: 10, OutputTokens: 5, Cost: 0.01}, Time: when},
+			{ID: "a2", ParentID: "u1", Role: "assistant", Content: "second", Agent: "Writer", Rating: "good", Time: when},
+		},
+		Head:  "a1",
+		Turns: []Turn{{Time: when, Agent: "Coder", Service: "gpt-4", Cost: 0.01}, {Time: when, Agent: "Writer", Service: "gpt-4", Cost: 0.02}},
+	}
+
+	exported, err := exportJSONL(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(exported), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], `{"turn":`) || !strings.Contains(lines[4], `"id":"a1"`) {
+		t.Fatalf("got lines\n%s", exported)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chat.jsonl")
+	if err := os.WriteFile(path, []byte(exported), 0644); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := importSession(dir, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Name != "chat" || imported.Head != "a1" {
+		t.Errorf("got name %q and head %q", imported.Name, imported.Head)
+	}
+	if !reflect.DeepEqual(imported.Turns, session.Turns) || imported.Cost() != session.Cost() {
+		t.Errorf("got turns %+v, want %+v", imported.Turns, session.Turns)
+	}
+	if !reflect.DeepEqual(sessionBranch(imported), sessionBranch(session)) {
+		t.Errorf("got branch %+v, want %+v", sessionBranch(imported), sessionBranch(session))
+	}
+	if len(imported.Messages) != len(session.Messages) {
+		t.Errorf("got %d messages, want %d", len(imported.Messages), len(session.Messages))
+	}
+
+	// The import is saved and can be loaded again
+	loaded, err := loadSession(dir, imported.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Turns, session.Turns) {
+		t.Errorf("saved turns %+v, want %+v", loaded.Turns, session.Turns)
+	}
+}
+
+func TestImportSessionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"empty", "\n\n", "contains no messages"},
+		{"only turns", `{"turn":{"agent":"Coder","cost":1}}`, "contains no messages"},
+		{"not JSON", `{"role":"user"}` + "\nnot json", "bad.jsonl:2"},
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.jsonl")
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := importSession(dir, path); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	// Messages without an ID get one
+	if err := os.WriteFile(path, []byte(`{"role":"user","content":"hi"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	session, err := importSession(dir, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Messages[0].ID == "" || session.Head != session.Messages[0].ID {
+		t.Errorf("got %+v", session.Messages)
+	}
+}
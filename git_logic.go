@@ -0,0 +1,621 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// fileChange describes a path whose content differs between two snapshots.
+type fileChange struct {
+	Path      string
+	Old       string
+	New       string
+	OldExists bool
+	NewExists bool
+}
+
+// Diff returns the change in unified diff format.
+func (fc *fileChange) Diff() string {
+	return unifiedDiff(fc.Path, fc.Old, fc.New, fc.OldExists, fc.NewExists)
+}
+
+// headCommit returns the commit HEAD points to, or nil on an unborn branch.
+func headCommit(r *git.Repository) (*object.Commit, error) {
+	ref, err := r.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.CommitObject(ref.Hash())
+}
+
+// blobContent returns the contents of the blob with the given hash.
+func blobContent(r *git.Repository, hash plumbing.Hash) (string, error) {
+	blob, err := r.BlobObject(hash)
+	if err != nil {
+		return "", err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// headContent returns the content of path in the HEAD commit.
+func headContent(r *git.Repository, path string) (string, bool, error) {
+	commit, err := headCommit(r)
+	if err != nil || commit == nil {
+		return "", false, err
+	}
+	file, err := commit.File(path)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	content, err := file.Contents()
+	return content, true, err
+}
+
+// indexContent returns the content of path in the index.
+func indexContent(r *git.Repository, path string) (string, bool, error) {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return "", false, err
+	}
+	entry, err := idx.Entry(path)
+	if err != nil {
+		return "", false, nil
+	}
+	content, err := blobContent(r, entry.Hash)
+	return content, true, err
+}
+
+// worktreeContent returns the content of path in the working tree.
+func worktreeContent(r *git.Repository, path string) (string, bool, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return "", false, err
+	}
+	data, err := os.ReadFile(filepath.Join(w.Filesystem.Root(), path))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
+
+// stagedChanges returns the differences between HEAD and the index.
+func stagedChanges(r *git.Repository) ([]fileChange, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []fileChange
+	for _, path := range sortedStatusPaths(status) {
+		fs := status[path]
+		if fs.Staging == git.Unmodified || fs.Staging == git.Untracked {
+			continue
+		}
+		change, err := stagedChange(r, path)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// stagedChange returns the difference between HEAD and the index for one path.
+func stagedChange(r *git.Repository, path string) (fileChange, error) {
+	change := fileChange{Path: path}
+	var err error
+	if change.Old, change.OldExists, err = headContent(r, path); err != nil {
+		return change, err
+	}
+	if change.New, change.NewExists, err = indexContent(r, path); err != nil {
+		return change, err
+	}
+	return change, nil
+}
+
+// worktreeChanges returns the differences between the index and the working tree,
+// including untracked files.
+func worktreeChanges(r *git.Repository) ([]fileChange, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []fileChange
+	for _, path := range sortedStatusPaths(status) {
+		if status[path].Worktree == git.Unmodified {
+			continue
+		}
+		change := fileChange{Path: path}
+		if change.Old, change.OldExists, err = indexContent(r, path); err != nil {
+			return nil, err
+		}
+		if change.New, change.NewExists, err = worktreeContent(r, path); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// sortedStatusPaths returns the paths of a status in a stable order.
+func sortedStatusPaths(status git.Status) []string {
+	paths := make([]string, 0, len(status))
+	for path := range status {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// changesDiff renders a list of changes as a single unified diff.
+func changesDiff(changes []fileChange) string {
+	var sb strings.Builder
+	for _, change := range changes {
+		sb.WriteString(change.Diff())
+	}
+	return sb.String()
+}
+
+// stagedDiff returns the staged changes of the repository in dir as a unified diff.
+func stagedDiff(dir string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	changes, err := stagedChanges(r)
+	if err != nil {
+		return "", err
+	}
+	return changesDiff(changes), nil
+}
+
+// worktreeDiff returns the unstaged changes of the repository in dir as a unified diff.
+func worktreeDiff(dir string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	changes, err := worktreeChanges(r)
+	if err != nil {
+		return "", err
+	}
+	return changesDiff(changes), nil
+}
+
+// recentCommits describes the last n commits reachable from HEAD.
+func recentCommits(dir string, n int) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+	commits, err := r.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	count := 0
+	err = commits.ForEach(func(commit *object.Commit) error {
+		if count >= n {
+			return storer.ErrStop
+		}
+		count++
+		sb.WriteString(fmt.Sprintf("commit %s\nAuthor: %s <%s>\nDate: %s\n\n%s\n\n",
+			commit.Hash.String()[:8], commit.Author.Name, commit.Author.Email,
+			commit.Author.When.Format(time.RFC1123Z), strings.TrimSpace(commit.Message)))
+		return nil
+	})
+	return sb.String(), err
+}
+
+// blameFile annotates each line of path in HEAD with the commit and author that last changed it.
+func blameFile(dir, path string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	commit, err := headCommit(r)
+	if err != nil {
+		return "", err
+	}
+	if commit == nil {
+		return "", fmt.Errorf("repository has no commits")
+	}
+	result, err := git.Blame(commit, path)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i, line := range result.Lines {
+		sb.WriteString(fmt.Sprintf("%s %-15.15s %s %4d| %s\n",
+			line.Hash.String()[:8], line.AuthorName, line.Date.Format("2006-01-02"), i+1, line.Text))
+	}
+	return sb.String(), nil
+}
+
+// gitAuthor returns the commit signature configured in the local or global git config.
+func gitAuthor(r *git.Repository) (*object.Signature, error) {
+	cfg, err := r.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return nil, err
+	}
+
+	name, email := cfg.Author.Name, cfg.Author.Email
+	if name == "" || email == "" {
+		name, email = cfg.User.Name, cfg.User.Email
+	}
+	if name == "" || email == "" {
+		return nil, fmt.Errorf("git user.name and user.email are not configured")
+	}
+
+	return &object.Signature{Name: name, Email: email, When: time.Now()}, nil
+}
+
+// commitStaged commits the index of the repository in dir with the given message.
+func commitStaged(dir, message string) (plumbing.Hash, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	author, err := gitAuthor(r)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return w.Commit(message, &git.CommitOptions{Author: author})
+}
+
+// fileStatusString summarises the git status of a file for display.
+func fileStatusString(status git.Status, path string) string {
+	fs, ok := status[path]
+	if !ok {
+		return "Unmodified"
+	}
+	if fs.Worktree == git.Untracked {
+		return "Untracked"
+	}
+
+	staged := fs.Staging != git.Unmodified && fs.Staging != git.Untracked
+	changed := fs.Worktree != git.Unmodified && fs.Worktree != git.Untracked
+	switch {
+	case staged && changed:
+		return "Partially Staged"
+	case staged:
+		return "Staged"
+	case changed:
+		return "Modified"
+	default:
+		return "Unmodified"
+	}
+}
+
+// setIndexContent stores content as a blob and points the index entry for path at it.
+func setIndexContent(r *git.Repository, path, content string) error {
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	writer, err := obj.Writer()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write([]byte(content)); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	hash, err := r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	entry, err := idx.Entry(path)
+	if err != nil {
+		entry = idx.Add(path)
+		entry.Mode = filemode.Regular
+	}
+	entry.Hash = hash
+	entry.Size = uint32(len(content))
+	entry.ModifiedAt = time.Now()
+
+	return r.Storer.SetIndex(idx)
+}
+
+// removeIndexEntry removes path from the index, leaving the working tree untouched.
+func removeIndexEntry(r *git.Repository, path string) error {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	if _, err := idx.Remove(path); err != nil {
+		return nil // Not in the index, nothing to do
+	}
+	return r.Storer.SetIndex(idx)
+}
+
+// stageFile adds the working tree version of path to the index.
+func stageFile(dir, path string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	_, exists, err := worktreeContent(r, path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return removeIndexEntry(r, path)
+	}
+	_, err = w.Add(path)
+	return err
+}
+
+// unstageFile resets the index entry for path to its HEAD version.
+func unstageFile(dir, path string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+
+	commit, err := headCommit(r)
+	if err != nil {
+		return err
+	}
+	if commit == nil {
+		return removeIndexEntry(r, path)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	entry, err := tree.FindEntry(path)
+	if err != nil {
+		return removeIndexEntry(r, path)
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	indexEntry, err := idx.Entry(path)
+	if err != nil {
+		indexEntry = idx.Add(path)
+	}
+	indexEntry.Hash = entry.Hash
+	indexEntry.Mode = entry.Mode
+	indexEntry.ModifiedAt = time.Now()
+
+	return r.Storer.SetIndex(idx)
+}
+
+// unstagedHunks returns the hunks that differ between the index and the working tree.
+func unstagedHunks(dir, path string) ([]diffHunk, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	old, _, err := indexContent(r, path)
+	if err != nil {
+		return nil, err
+	}
+	new, _, err := worktreeContent(r, path)
+	if err != nil {
+		return nil, err
+	}
+	return diffHunks(old, new), nil
+}
+
+// stagedHunks returns the hunks that differ between HEAD and the index.
+func stagedHunks(dir, path string) ([]diffHunk, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	change, err := stagedChange(r, path)
+	if err != nil {
+		return nil, err
+	}
+	return diffHunks(change.Old, change.New), nil
+}
+
+// stageHunk adds a single working tree hunk of path to the index.
+func stageHunk(dir, path string, hunk int) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	old, _, err := indexContent(r, path)
+	if err != nil {
+		return err
+	}
+	new, _, err := worktreeContent(r, path)
+	if err != nil {
+		return err
+	}
+
+	hunks := diffHunks(old, new)
+	if hunk < 0 || hunk >= len(hunks) {
+		return fmt.Errorf("hunk %d of %s no longer exists", hunk+1, path)
+	}
+	content := applyHunks(old, hunks, func(i int) bool { return i == hunk })
+	return setIndexContent(r, path, content)
+}
+
+// unstageHunk removes a single staged hunk of path from the index.
+func unstageHunk(dir, path string, hunk int) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	change, err := stagedChange(r, path)
+	if err != nil {
+		return err
+	}
+
+	hunks := diffHunks(change.Old, change.New)
+	if hunk < 0 || hunk >= len(hunks) {
+		return fmt.Errorf("hunk %d of %s no longer exists", hunk+1, path)
+	}
+	content := applyHunks(change.Old, hunks, func(i int) bool { return i != hunk })
+	// Unstaging all of a newly added file takes it out of the index again
+	if !change.OldExists && content == change.Old {
+		return removeIndexEntry(r, path)
+	}
+	return setIndexContent(r, path, content)
+}
+
+// discardChanges restores the working tree version of path from the index,
+// deleting it if it is untracked.
+func discardChanges(dir, path string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	fullPath := filepath.Join(w.Filesystem.Root(), path)
+
+	content, tracked, err := indexContent(r, path)
+	if err != nil {
+		return err
+	}
+	if !tracked {
+		return os.Remove(fullPath)
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(fullPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return os.WriteFile(fullPath, []byte(content), mode)
+}
+
+// branchHistory is the work done on the current branch since it left a base branch.
+type branchHistory struct {
+	Base    string           // Name of the base branch
+	Head    string           // Name of the current branch
+	Commits []*object.Commit // Commits on the current branch, newest first
+	Diff    string           // Aggregate diff between the merge base and HEAD
+}
+
+// currentBranchHistory collects the commits and diff between base and the current branch.
+func currentBranchHistory(dir, base string) (*branchHistory, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	headRef, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.CommitObject(headRef.Hash())
+	if err != nil {
+		return nil, err
+	}
+	baseHash, err := r.ResolveRevision(plumbing.Revision(base))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", base, err)
+	}
+	baseCommit, err := r.CommitObject(*baseHash)
+	if err != nil {
+		return nil, err
+	}
+
+	bases, err := head.MergeBase(baseCommit)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("%s and %s have no common history", headRef.Name().Short(), base)
+	}
+	mergeBase := bases[0]
+
+	// Commits already on base, including those merged into the current branch,
+	// are not part of its history
+	onBase := map[plumbing.Hash]bool{}
+	err = object.NewCommitPreorderIter(baseCommit, nil, nil).ForEach(func(commit *object.Commit) error {
+		onBase[commit.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	history := &branchHistory{Base: base, Head: headRef.Name().Short()}
+	err = object.NewCommitPreorderIter(head, onBase, nil).ForEach(func(commit *object.Commit) error {
+		history.Commits = append(history.Commits, commit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := mergeBase.Patch(head)
+	if err != nil {
+		return nil, err
+	}
+	history.Diff = patch.String()
+
+	return history, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestUnstageHunkOfNewFile(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("a\nb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := stageFile(dir, "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unstageHunk(dir, "new.txt", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, tracked, err := indexContent(r, "new.txt"); err != nil || tracked {
+		t.Errorf("new.txt is still in the index (err %v)", err)
+	}
+}
+
+func TestCurrentBranchHistorySkipsMergedBaseCommits(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkout := func(branch string, create bool) {
+		t.Helper()
+		if err := w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(branch), Create: create}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commitFile(t, dir, "a.txt", "a\n")
+	checkout("feature", true)
+	first := commitFile(t, dir, "b.txt", "b\n")
+	checkout("master", false)
+	onBase := commitFile(t, dir, "c.txt", "c\n")
+
+	// Merge master into feature
+	checkout("feature", false)
+	if err := os.WriteFile(filepath.Join(dir, "c.txt"), []byte("c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	merge, err := w.Commit("merge master", &git.CommitOptions{
+		Author:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Parents: []plumbing.Hash{first, onBase},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := commitFile(t, dir, "d.txt", "d\n")
+
+	history, err := currentBranchHistory(dir, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []plumbing.Hash{last, merge, first}
+	if len(history.Commits) != len(want) {
+		t.Fatalf("got %d commits, want %d", len(history.Commits), len(want))
+	}
+	for i, commit := range history.Commits {
+		if commit.Hash != want[i] {
+			t.Errorf("commit %d is %q, want %s", i, commit.Message, want[i])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// codeSpan is a piece of a line of code and the class the highlighter gave
+// it: "kw", "str", "num", "com", or empty for plain text.
+type codeSpan struct {
+	Class string
+	Text  string
+}
+
+// codeToken matches the parts of a line the highlighter colours.
+var codeToken = regexp.MustCompile("(//.*|#.*|--.*|/\\*.*?\\*/)|(\"(?:\\\\.|[^\"\\\\])*\"|'(?:\\\\.|[^'\\\\])*'|`[^`]*`)|\\b(\\d+(?:\\.\\d+)?)\\b|\\b([A-Za-z_]\\w*)\\b")
+
+// languageKeywords lists the keywords of the languages agents usually answer in.
+var languageKeywords = map[string]string{
+	"go": `break case chan const continue default defer else fallthrough for func go goto if import
+		interface map package range return select struct switch type var nil true false iota
+		int int64 float64 string bool byte rune error any`,
+	"python": `and as assert async await break class continue def del elif else except finally for from global
+		if import in is lambda None nonlocal not or pass raise return try while with yield True False self`,
+	"javascript": `async await break case catch class const continue default delete do else export extends finally
+		for from function if import in instanceof let new null return static super switch this throw try
+		typeof undefined var void while yield true false interface type enum implements`,
+	"rust": `as async await break const continue crate else enum extern false fn for if impl in let loop match
+		mod move mut pub ref return self Self static struct super trait true type unsafe use where while
+		i32 i64 u8 u32 u64 usize f64 bool str String Vec Option Some None Result Ok Err`,
+	"shell": `if then else elif fi case esac for while until do done in function return local export echo
+		exit set unset readonly shift source true false`,
+	"sql": `select from where and or not insert into values update set delete create table alter drop index
+		join left right inner outer on group by order having limit as distinct null is primary key foreign
+		references union all begin commit rollback`,
+}
+
+// languageAliases maps fence languages to the keyword sets above.
+var languageAliases = map[string]string{
+	"golang": "go", "py": "python", "python3": "python", "js": "javascript", "jsx": "javascript",
+	"ts": "javascript", "tsx": "javascript", "typescript": "javascript", "rs": "rust",
+	"sh": "shell", "bash": "shell", "zsh": "shell", "console": "shell",
+}
+
+// hashComments lists languages where # starts a comment.
+var hashComments = map[string]bool{
+	"python": true, "shell": true, "ruby": true, "rb": true, "yaml": true, "yml": true, "toml": true,
+	"perl": true, "r": true, "dockerfile": true, "makefile": true, "make": true,
+}
+
+// keywordSets holds each language's keywords; unknown languages use all of them
+var keywordSets = map[string]map[string]bool{}
+
+func init() {
+	all := make(map[string]bool)
+	for lang, words := range languageKeywords {
+		set := make(map[string]bool)
+		for _, word := range strings.Fields(words) {
+			set[word] = true
+			all[word] = true
+		}
+		keywordSets[lang] = set
+	}
+	keywordSets[""] = all
+}
+
+// codeLanguage normalises a fence language, returning "" when it is unknown.
+func codeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if alias, ok := languageAliases[lang]; ok {
+		lang = alias
+	}
+	if _, ok := keywordSets[lang]; ok || hashComments[lang] {
+		return lang
+	}
+	return ""
+}
+
+// highlightLine splits a line of code into spans of keywords, strings,
+// numbers, comments and plain text. It works line by line, so block comments
+// spanning lines are not recognised.
+func highlightLine(line, lang string) []codeSpan {
+	lang = codeLanguage(lang)
+	keywords, ok := keywordSets[lang]
+	if !ok {
+		keywords = keywordSets[""]
+	}
+	isSQL := lang == "sql"
+
+	var spans []codeSpan
+	last := 0
+	for _, match := range codeToken.FindAllStringSubmatchIndex(line, -1) {
+		start, end := match[0], match[1]
+		if start < last {
+			continue
+		}
+		class := ""
+		switch {
+		case match[2] >= 0:
+			comment := line[start:end]
+			if (strings.HasPrefix(comment, "#") && !hashComments[lang]) || (strings.HasPrefix(comment, "--") && !isSQL) {
+				continue
+			}
+			class = "com"
+			// A comment runs to the end of the line
+			if !strings.HasPrefix(comment, "/*") {
+				end = len(line)
+			}
+		case match[4] >= 0:
+			class = "str"
+		case match[6] >= 0:
+			class = "num"
+		case match[8] >= 0:
+			word := line[start:end]
+			if isSQL {
+				word = strings.ToLower(word)
+			}
+			if !keywords[word] {
+				continue
+			}
+			class = "kw"
+		}
+		if start > last {
+			spans = append(spans, codeSpan{Text: line[last:start]})
+		}
+		spans = append(spans, codeSpan{Class: class, Text: line[start:end]})
+		last = end
+		if end == len(line) {
+			break
+		}
+	}
+	if last < len(line) {
+		spans = append(spans, codeSpan{Text: line[last:]})
+	}
+	return spans
+}
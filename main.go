@@ -1,16 +1,31 @@
 package main
 
 import (
+	"os"
+	"sync"
 	"time"
 )
 
 // ServiceUsage tracks the number of API requests made for each service.
 var serviceUsage = make(map[string]int)
 
+// usageMu guards serviceUsage and the token counts of the services
+var usageMu sync.Mutex
+
 func main() {
 
+	// Subcommands like export and import run without the UI
+	if runCLI(os.Args[1:]) {
+		return
+	}
+
 	core := NewCore()
 	ui := NewUI(core)
+
+	// Offer to resume a saved session
+	if sessions, _ := listSessions(core.projectDir); len(sessions) > 0 {
+		ui.ShowSessionPicker(core)
+	}
 	ticker := time.NewTicker(time.Millisecond * 500)
 	running := true
 
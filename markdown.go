@@ -0,0 +1,203 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// Tab width used when laying out code blocks
+const codeTabWidth = 4
+
+// codeColors maps highlighter classes to tview colours
+var codeColors = map[string]string{
+	"kw":  "#569cd6",
+	"str": "#ce9178",
+	"num": "#b5cea8",
+	"com": "#6a9955",
+}
+
+var (
+	headingLine  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletLine   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	numberedLine = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	quoteLine    = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	ruleLine     = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	inlineCode   = regexp.MustCompile("`[^`]+`")
+	boldText     = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	spacedWord   = regexp.MustCompile(` *[^ ]+`)
+)
+
+// renderMarkdown turns Markdown into tview tagged text wrapped to width
+// columns, or unwrapped when width is not positive. Everything from the
+// message is escaped, so a "[" in a reply is never taken for a colour tag.
+func renderMarkdown(content string, width int) string {
+	var lines []string
+	for _, block := range splitFences(content) {
+		if block.Code {
+			lines = append(lines, renderCodeBlock(block, width)...)
+			continue
+		}
+		for _, line := range strings.Split(block.Text, "\n") {
+			lines = append(lines, renderMarkdownLine(line, width)...)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderMarkdownLine renders a line of prose, wrapping lists and quotes under their markers.
+func renderMarkdownLine(line string, width int) []string {
+	if match := headingLine.FindStringSubmatch(line); match != nil {
+		color := "yellow"
+		if len(match[1]) > 1 {
+			color = "orange"
+		}
+		return wrapTagged("["+color+"::b]"+renderInline(match[2])+"[-::-]", "", "", width)
+	}
+	if ruleLine.MatchString(line) {
+		rule := 40
+		if width > 0 && width < rule {
+			rule = width
+		}
+		return []string{"[gray]" + strings.Repeat("─", rule) + "[-]"}
+	}
+	if match := bulletLine.FindStringSubmatch(line); match != nil {
+		indent := match[1]
+		return wrapTagged(renderInline(match[2]), indent+"• ", indent+"  ", width)
+	}
+	if match := numberedLine.FindStringSubmatch(line); match != nil {
+		indent, number := match[1], match[2]
+		return wrapTagged(renderInline(match[3]), indent+number+" ", indent+strings.Repeat(" ", len(number)+1), width)
+	}
+	if match := quoteLine.FindStringSubmatch(line); match != nil {
+		return wrapTagged("[gray]"+renderInline(match[1])+"[-]", "[gray]│[-] ", "[gray]│[-] ", width)
+	}
+	return wrapTagged(renderInline(line), "", "", width)
+}
+
+// renderInline escapes prose and styles inline code and bold text.
+func renderInline(text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, match := range inlineCode.FindAllStringIndex(text, -1) {
+		sb.WriteString(renderBold(text[last:match[0]]))
+		sb.WriteString("[aqua]" + tview.Escape(text[match[0]+1:match[1]-1]) + "[-]")
+		last = match[1]
+	}
+	sb.WriteString(renderBold(text[last:]))
+	return sb.String()
+}
+
+// renderBold escapes text and makes **bold** and __bold__ runs bold.
+func renderBold(text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, match := range boldText.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(tview.Escape(text[last:match[0]]))
+		inner := text[match[2]:match[3]]
+		if match[2] < 0 {
+			inner = text[match[4]:match[5]]
+		}
+		sb.WriteString("[::b]" + tview.Escape(inner) + "[::-]")
+		last = match[1]
+	}
+	sb.WriteString(tview.Escape(text[last:]))
+	return sb.String()
+}
+
+// wrapTagged word-wraps tagged text, starting the first line with prefix and
+// the following lines with indent so lists and quotes stay aligned. Runs of
+// spaces are kept as written, except where a line is broken.
+func wrapTagged(text, prefix, indent string, width int) []string {
+	if width <= 0 {
+		return []string{prefix + text}
+	}
+
+	var lines []string
+	line := prefix
+	lineWidth := tview.TaggedStringWidth(prefix)
+	empty := true
+	for _, token := range spacedWord.FindAllString(text, -1) {
+		word := strings.TrimLeft(token, " ")
+		gap := token[:len(token)-len(word)]
+		wordWidth := tview.TaggedStringWidth(word)
+		if !empty && lineWidth+len(gap)+wordWidth > width {
+			lines = append(lines, line)
+			line = indent
+			lineWidth = tview.TaggedStringWidth(indent)
+			gap = "" // The line break takes the place of the spaces
+		}
+		line += gap + word
+		lineWidth += len(gap) + wordWidth
+		empty = false
+	}
+	return append(lines, line)
+}
+
+// renderCodeBlock colours a fenced code block and wraps long lines, continuing
+// them at the indentation of the line they belong to.
+func renderCodeBlock(block textBlock, width int) []string {
+	gutter := "[gray]│[-] "
+	lines := []string{"[gray]┌ " + tview.Escape(block.Lang) + "[-]"}
+
+	available := width - 2 // Room left after the gutter
+	for _, line := range strings.Split(block.Text, "\n") {
+		line = strings.ReplaceAll(line, "\t", strings.Repeat(" ", codeTabWidth))
+		indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+		spans := highlightLine(line, block.Lang)
+
+		// Only wrap when there is space for code after the indentation
+		continuation := len(indent) + 2
+		if width <= 0 || available-continuation <= 10 {
+			lines = append(lines, gutter+colorSpans(spans))
+			continue
+		}
+		for i, chunk := range splitSpans(spans, available, available-continuation) {
+			prefix := ""
+			if i > 0 {
+				prefix = indent + "[gray]↪[-] "
+			}
+			lines = append(lines, gutter+prefix+colorSpans(chunk))
+		}
+	}
+	return append(lines, "[gray]└[-]")
+}
+
+// splitSpans breaks a highlighted line into chunks, the first at most first
+// runes long and the rest at most rest runes, keeping each span's class.
+func splitSpans(spans []codeSpan, first, rest int) [][]codeSpan {
+	var chunks [][]codeSpan
+	var chunk []codeSpan
+	room := first
+	for _, span := range spans {
+		runes := []rune(span.Text)
+		for len(runes) > room {
+			if room > 0 {
+				chunk = append(chunk, codeSpan{Class: span.Class, Text: string(runes[:room])})
+				runes = runes[room:]
+			}
+			chunks = append(chunks, chunk)
+			chunk = nil
+			room = rest
+		}
+		if len(runes) > 0 {
+			chunk = append(chunk, codeSpan{Class: span.Class, Text: string(runes)})
+			room -= len(runes)
+		}
+	}
+	return append(chunks, chunk)
+}
+
+// colorSpans escapes highlighted code and colours it for a TextView.
+func colorSpans(spans []codeSpan) string {
+	var sb strings.Builder
+	for _, span := range spans {
+		if color, ok := codeColors[span.Class]; ok {
+			sb.WriteString("[" + color + "]" + tview.Escape(span.Text) + "[-]")
+			continue
+		}
+		sb.WriteString(tview.Escape(span.Text))
+	}
+	return sb.String()
+}
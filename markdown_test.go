@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrapTagged(t *testing.T) {
+	tests := []struct {
+		name           string
+		text           string
+		prefix, indent string
+		width          int
+		want           []string
+	}{
+		{"unwrapped", "one two", "", "", 0, []string{"one two"}},
+		{"fits", "one two", "", "", 7, []string{"one two"}},
+		{"wraps", "one two three", "", "", 8, []string{"one two", "three"}},
+		{"keeps runs of spaces", "a  b   c", "", "", 20, []string{"a  b   c"}},
+		{"drops spaces at a break", "one    two", "", "", 5, []string{"one", "two"}},
+		{"keeps leading spaces", "  indented", "", "", 20, []string{"  indented"}},
+		{"aligns under the marker", "one two three", "• ", "  ", 9, []string{"• one two", "  three"}},
+		{"tags take no width", "[red]one[-] two", "", "", 7, []string{"[red]one[-] two"}},
+		{"long words overflow", "abcdefghij k", "", "", 5, []string{"abcdefghij", "k"}},
+	}
+	for _, tt := range tests {
+		if got := wrapTagged(tt.text, tt.prefix, tt.indent, tt.width); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		width   int
+		want    string
+	}{
+		{"heading", "# Title", 20, "[yellow::b]Title[-::-]"},
+		{"subheading", "## Sub", 20, "[orange::b]Sub[-::-]"},
+		{"bullet with inline styles", "- item **bold** `code`", 40, "• item [::b]bold[::-] [aqua]code[-]"},
+		{"numbered list wraps under its text", "1. one two three four five six", 20, "1. one two three\n   four five six"},
+		{"quote", "> quote", 20, "[gray]│[-] [gray]quote[-]"},
+		{"rule fits the width", "---", 10, "[gray]──────────[-]"},
+		{"tags in prose are escaped", "a [red] tag", 20, "a [red[] tag"},
+		{"code block", "```go\nfunc main() {}\n```", 40, "[gray]┌ go[-]\n[gray]│[-] [#569cd6]func[-] main() {}\n[gray]└[-]"},
+	}
+	for _, tt := range tests {
+		if got := renderMarkdown(tt.content, tt.width); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
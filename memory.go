@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Directory, relative to the project, holding what each agent remembers
+const memoryDir = ".pixelheat/memory"
+
+// Most facts injected into a directive, newest kept
+const maxMemoryFacts = 50
+
+// memoryInstructions tell agents with the memory tool how to remember things.
+const memoryInstructions = `You have a memory that lasts across sessions of this project. When you learn a fact worth keeping, such as a decision, a convention or a preference of the user, add it to your answer on its own line as:
+REMEMBER: <the fact, in one sentence>
+Only remember things that will still be true and useful later.`
+
+// rememberLine matches the lines agents use to store a fact.
+var rememberLine = regexp.MustCompile(`(?m)^\s*REMEMBER:\s*(.+?)\s*$`)
+
+// MemoryFact is something an agent remembers about the project.
+type MemoryFact struct {
+	ID      string    `json:"id"`
+	Text    string    `json:"text"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message,omitempty"` // Answer the fact came from, empty once the user edits it
+}
+
+// memoryPath returns the file holding an agent's memory. The slug keeps it
+// readable and a hash of the exact name keeps agents whose names only differ
+// in punctuation or case apart.
+func memoryPath(projectDir, agent string) string {
+	slug := strings.Trim(nonBranchChars.ReplaceAllString(strings.ToLower(agent), "-"), "-.")
+	hash := fnv.New32a()
+	hash.Write([]byte(agent))
+	return filepath.Join(projectDir, memoryDir, fmt.Sprintf("%s-%08x.json", slug, hash.Sum32()))
+}
+
+// loadMemory reads the facts an agent remembers; none is not an error.
+func loadMemory(projectDir, agent string) ([]MemoryFact, error) {
+	data, err := os.ReadFile(memoryPath(projectDir, agent))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var facts []MemoryFact
+	if err := json.Unmarshal(data, &facts); err != nil {
+		return nil, fmt.Errorf("reading memory of %s: %w", agent, err)
+	}
+	return facts, nil
+}
+
+// saveMemory writes the facts an agent remembers.
+func saveMemory(projectDir, agent string, facts []MemoryFact) error {
+	path := memoryPath(projectDir, agent)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(facts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// rememberedFacts returns the facts an answer asks to remember.
+func rememberedFacts(response string) []string {
+	var facts []string
+	for _, match := range rememberLine.FindAllStringSubmatch(response, -1) {
+		facts = append(facts, match[1])
+	}
+	return facts
+}
+
+// memoryMessage presents remembered facts to the agent.
+func memoryMessage(facts []MemoryFact) string {
+	if len(facts) > maxMemoryFacts {
+		facts = facts[len(facts)-maxMemoryFacts:]
+	}
+	var sb strings.Builder
+	sb.WriteString("What you remember about this project from earlier sessions:")
+	for _, fact := range facts {
+		sb.WriteString("\n- " + fact.Text)
+	}
+	return sb.String()
+}
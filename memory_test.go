@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemoryPathKeepsSimilarNamesApart(t *testing.T) {
+	names := []string{"Reviewer", "reviewer", "Re-viewer", "Re viewer", "Reviewer!"}
+	seen := map[string]string{}
+	for _, name := range names {
+		path := memoryPath("project", name)
+		if other, ok := seen[path]; ok {
+			t.Errorf("%q and %q share %s", name, other, path)
+		}
+		seen[path] = name
+	}
+	if memoryPath("project", "Reviewer") != memoryPath("project", "Reviewer") {
+		t.Error("memoryPath is not stable")
+	}
+}
+
+func TestRememberedFacts(t *testing.T) {
+	tests := []struct {
+		response string
+		want     []string
+	}{
+		{"No facts here.", nil},
+		{"Done.\nREMEMBER: Tabs are used for indentation.\n", []string{"Tabs are used for indentation."}},
+		{"  REMEMBER:   Use go 1.20  \nmore\nREMEMBER: Tests are table driven", []string{"Use go 1.20", "Tests are table driven"}},
+		{"Don't REMEMBER: this, it is mid-line", nil},
+	}
+	for _, tt := range tests {
+		if got := rememberedFacts(tt.response); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("rememberedFacts(%q) = %q, want %q", tt.response, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryFollowsTheKeptAnswer(t *testing.T) {
+	reloadAgents(nil)
+	core := &Core{projectDir: t.TempDir()}
+	rejected := Message{ID: "a1", Role: "assistant", Agent: "PixelHeat", Content: "REMEMBER: Use tabs"}
+	kept := Message{ID: "a2", Role: "assistant", Agent: "PixelHeat", Content: "REMEMBER: Use spaces"}
+
+	core.rememberFrom(rejected)
+	if err := core.Remember("PixelHeat", "The user likes short answers"); err != nil {
+		t.Fatal(err)
+	}
+	core.forgetFrom(rejected)
+	core.rememberFrom(kept)
+
+	facts, err := core.GetMemory("PixelHeat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, fact := range facts {
+		texts = append(texts, fact.Text)
+	}
+	if want := []string{"The user likes short answers", "Use spaces"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("remembered %q, want %q", texts, want)
+	}
+}
@@ -1,72 +1,437 @@
 package main
 
-// MessageStack represents a stack of messages.
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MessageStack represents a tree of messages. Each message points at its
+// parent, and the current conversation is the branch from the root to head.
+// Editing an earlier message starts a new branch next to the old one.
 type MessageStack struct {
-	messages []Message
+	mu       sync.RWMutex
+	messages []Message           // All messages of every branch, in the order they were inserted
+	head     string              // ID of the last message of the current branch
+	index    map[string]int      // Position of each message in messages
+	children map[string][]string // IDs of the messages following each message, oldest first
 }
 
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	ID       string    `json:"id"`
+	ParentID string    `json:"parent_id,omitempty"` // Message this one follows, empty for the first message
+	Role     string    `json:"role"`
+	Content  string    `json:"content"`
+	Time     time.Time `json:"time"`
+	Agent    string    `json:"agent,omitempty"`   // Agent that sent or answered the message
+	Service  string    `json:"service,omitempty"` // Model that produced the message
+	Usage    Usage     `json:"usage"`             // Tokens and cost of producing the message
+	Context  []string  `json:"context,omitempty"` // Files and context sources attached to the request
+	Rating   string    `json:"rating,omitempty"`  // "good" or "bad" when the user rated an answer
+	Step     string    `json:"step,omitempty"`    // Pipeline step the message belongs to, like "Review 2/3"
+}
+
+// Usage is the token usage and cost of a completion.
+type Usage struct {
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// newMessageID returns a random identifier for a message.
+func newMessageID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
 }
 
-// setMessages sets the messages in the stack.
+// metadata describes who produced the message, when, and at what cost.
+func (m *Message) metadata() string {
+	parts := []string{m.ID, m.Time.Format("2006-01-02 15:04:05")}
+	if m.Agent != "" {
+		parts = append(parts, m.Agent)
+	}
+	if m.Service != "" {
+		parts = append(parts, m.Service)
+	}
+	if m.Usage.InputTokens > 0 || m.Usage.OutputTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d in / %d out tokens", m.Usage.InputTokens, m.Usage.OutputTokens))
+		parts = append(parts, fmt.Sprintf("$%.4f", m.Usage.Cost))
+	}
+	if len(m.Context) > 0 {
+		parts = append(parts, "context: "+strings.Join(m.Context, ", "))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// setMessages sets the messages in the stack, continuing from the last one.
+// Messages without parents, from before the stack was a tree, are chained in order.
 func (ms *MessageStack) setMessages(messages []Message) {
+	ms.setTree(messages, "")
+}
+
+// setTree sets all messages of the tree and the head of the current branch.
+func (ms *MessageStack) setTree(messages []Message, head string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 	ms.messages = messages
+
+	linear := true
+	for _, msg := range messages {
+		if msg.ParentID != "" {
+			linear = false
+			break
+		}
+	}
+	if linear {
+		for i := 1; i < len(ms.messages); i++ {
+			ms.messages[i].ParentID = ms.messages[i-1].ID
+		}
+	}
+	ms.reindex()
+
+	ms.head = head
+	if _, ok := ms.message(head); !ok {
+		ms.head = ""
+		if len(ms.messages) > 0 {
+			ms.head = ms.leafOf(ms.messages[len(ms.messages)-1].ID)
+		}
+	}
+}
+
+// reindex rebuilds the lookups of messages by ID and by parent.
+func (ms *MessageStack) reindex() {
+	ms.index = make(map[string]int, len(ms.messages))
+	ms.children = make(map[string][]string)
+	for i, msg := range ms.messages {
+		ms.index[msg.ID] = i
+		ms.children[msg.ParentID] = append(ms.children[msg.ParentID], msg.ID)
+	}
 }
 
 // clearMessages clears all messages from the stack.
 func (ms *MessageStack) clearMessages() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 	ms.messages = []Message{}
+	ms.head = ""
+	ms.reindex()
+}
+
+// insertMessage appends a message to the current branch, assigning it an ID and timestamp.
+func (ms *MessageStack) insertMessage(msg Message) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if msg.ID == "" {
+		msg.ID = newMessageID()
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	if ms.index == nil {
+		ms.reindex()
+	}
+	msg.ParentID = ms.head
+	ms.messages = append(ms.messages, msg)
+	ms.index[msg.ID] = len(ms.messages) - 1
+	ms.children[msg.ParentID] = append(ms.children[msg.ParentID], msg.ID)
+	ms.head = msg.ID
 }
 
 // insertUserMessage inserts a user message into the stack.
 func (ms *MessageStack) insertUserMessage(content string) {
-	ms.messages = append(ms.messages, Message{Role: "user", Content: content})
+	ms.insertMessage(Message{Role: "user", Content: content})
 }
 
 // insertSystemMessage inserts a system message into the stack.
 func (ms *MessageStack) insertSystemMessage(content string) {
-	ms.messages = append(ms.messages, Message{Role: "system", Content: content})
+	ms.insertMessage(Message{Role: "system", Content: content})
 }
 
 // insertAssistantMessage inserts an assistant message into the stack.
 func (ms *MessageStack) insertAssistantMessage(content string) {
-	ms.messages = append(ms.messages, Message{Role: "assistant", Content: content})
+	ms.insertMessage(Message{Role: "assistant", Content: content})
 }
 
-// getAllUserMessages returns all user messages in the stack.
+// getAllUserMessages returns all user messages on the current branch.
 func (ms *MessageStack) getAllUserMessages() []Message {
 	return ms.getMessagesByRole("user")
 }
 
-// getAllAssistantMessages returns all assistant messages in the stack.
+// getAllAssistantMessages returns all assistant messages on the current branch.
 func (ms *MessageStack) getAllAssistantMessages() []Message {
 	return ms.getMessagesByRole("assistant")
 }
 
-// getAllSystemMessages returns all system messages in the stack.
+// getAllSystemMessages returns all system messages on the current branch.
 func (ms *MessageStack) getAllSystemMessages() []Message {
 	return ms.getMessagesByRole("system")
 }
 
-// getAllMessages returns all messages in the stack.
+// getAllMessages returns the messages of the current branch, oldest first.
 func (ms *MessageStack) getAllMessages() []Message {
-	return ms.messages
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.branch()
+}
+
+// branch returns the messages of the current branch, oldest first.
+func (ms *MessageStack) branch() []Message {
+	var branch []Message
+	for id := ms.head; id != ""; {
+		msg, ok := ms.message(id)
+		if !ok {
+			break
+		}
+		branch = append(branch, msg)
+		id = msg.ParentID
+	}
+
+	// Reverse so the root comes first
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	return branch
+}
+
+// getBranchLabels returns the messages of the current branch together with
+// the branch label of each, so a conversation is rendered from one snapshot.
+func (ms *MessageStack) getBranchLabels() ([]Message, map[string]string) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	branch := ms.branch()
+	labels := make(map[string]string, len(branch))
+	for _, msg := range branch {
+		labels[msg.ID] = ms.branchLabel(msg.ID)
+	}
+	return branch, labels
+}
+
+// getTree returns a copy of every message of every branch.
+func (ms *MessageStack) getTree() []Message {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return append([]Message(nil), ms.messages...)
+}
+
+// getHead returns the ID of the last message on the current branch.
+func (ms *MessageStack) getHead() string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.head
+}
+
+// getMessage returns the message with the given ID.
+func (ms *MessageStack) getMessage(id string) (Message, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.message(id)
+}
+
+// message returns the message with the given ID.
+func (ms *MessageStack) message(id string) (Message, bool) {
+	i, ok := ms.index[id]
+	if !ok {
+		return Message{}, false
+	}
+	return ms.messages[i], true
+}
+
+// getSiblings returns the alternatives to a message: the messages with the
+// same role that follow the same conversation message, oldest first.
+func (ms *MessageStack) getSiblings(id string) []Message {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.siblings(id)
+}
+
+// siblings looks for alternatives below the conversation parent, passing
+// through the system messages in between.
+func (ms *MessageStack) siblings(id string) []Message {
+	msg, ok := ms.message(id)
+	if !ok {
+		return nil
+	}
+
+	var positions []int
+	var visit func(parent string)
+	visit = func(parent string) {
+		for _, child := range ms.children[parent] {
+			other, _ := ms.message(child)
+			if other.Role == msg.Role {
+				positions = append(positions, ms.index[child])
+			}
+			if other.Role == "system" {
+				visit(child)
+			}
+		}
+	}
+	visit(ms.conversationParent(msg))
+
+	sort.Ints(positions)
+	siblings := make([]Message, len(positions))
+	for i, position := range positions {
+		siblings[i] = ms.messages[position]
+	}
+	return siblings
+}
+
+// conversationParent returns the ID of the closest ancestor of a message that
+// isn't a system message, as directives and files are replaced every turn.
+func (ms *MessageStack) conversationParent(msg Message) string {
+	id := msg.ParentID
+	for id != "" {
+		parent, ok := ms.message(id)
+		if !ok || parent.Role != "system" {
+			return id
+		}
+		id = parent.ParentID
+	}
+	return ""
+}
+
+// leafOf follows the most recent replies from a message to the end of its branch.
+func (ms *MessageStack) leafOf(id string) string {
+	for {
+		children := ms.children[id]
+		if len(children) == 0 {
+			return id
+		}
+		id = children[len(children)-1]
+	}
+}
+
+// showMessage makes a message part of the current branch, continuing to the end of its branch.
+func (ms *MessageStack) showMessage(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.message(id); !ok {
+		return fmt.Errorf("message %s not found", id)
+	}
+	ms.head = ms.leafOf(id)
+	return nil
+}
+
+// lastReply returns the assistant message at the end of the current branch.
+func (ms *MessageStack) lastReply() (Message, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	msg, ok := ms.message(ms.head)
+	if !ok || msg.Role != "assistant" {
+		return Message{}, false
+	}
+	return msg, true
+}
+
+// branchFrom moves head to the parent of a message, so the next message
+// inserted starts a new branch alongside it.
+func (ms *MessageStack) branchFrom(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	msg, ok := ms.message(id)
+	if !ok {
+		return fmt.Errorf("message %s not found", id)
+	}
+	ms.head = ms.conversationParent(msg)
+	return nil
+}
+
+// switchBranch moves to the sibling delta places away from a message and
+// continues to the end of that branch, returning the sibling's ID.
+func (ms *MessageStack) switchBranch(id string, delta int) (string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	siblings := ms.siblings(id)
+	for i, sibling := range siblings {
+		if sibling.ID != id {
+			continue
+		}
+		target := i + delta
+		if target < 0 || target >= len(siblings) {
+			return id, fmt.Errorf("no more branches in that direction")
+		}
+		ms.head = ms.leafOf(siblings[target].ID)
+		return siblings[target].ID, nil
+	}
+	return id, fmt.Errorf("message %s not found", id)
+}
+
+// rateMessage marks an assistant message as a good or bad answer, or clears
+// the rating when rating is empty.
+func (ms *MessageStack) rateMessage(id, rating string) error {
+	if rating != "" && rating != "good" && rating != "bad" {
+		return fmt.Errorf("rating must be good or bad, not %q", rating)
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	i, ok := ms.index[id]
+	if !ok {
+		return fmt.Errorf("message %s not found", id)
+	}
+	if ms.messages[i].Role != "assistant" {
+		return fmt.Errorf("only answers can be rated")
+	}
+	ms.messages[i].Rating = rating
+	return nil
+}
+
+// ratingLabel shows a message's rating next to its role.
+func ratingLabel(rating string) string {
+	switch rating {
+	case "good":
+		return " [green](good)[-]"
+	case "bad":
+		return " [red](bad)[-]"
+	}
+	return ""
+}
+
+// branchLabel describes which of its alternatives a message is, e.g. " (2/3)".
+func (ms *MessageStack) branchLabel(id string) string {
+	siblings := ms.siblings(id)
+	if len(siblings) < 2 {
+		return ""
+	}
+	for i, sibling := range siblings {
+		if sibling.ID == id {
+			return fmt.Sprintf(" (%d/%d)", i+1, len(siblings))
+		}
+	}
+	return ""
 }
 
 // getFormattedText returns the formatted text representation of the messages.
 func (ms *MessageStack) getFormattedText() string {
 	var formattedText string
-	for _, msg := range ms.messages {
-		switch msg.Role {
-		case "user":
-			formattedText += "[::b]User::[-] " + msg.Content + "\n"
-		case "assistant":
-			formattedText += "[::b]Assistant::[-] " + msg.Content + "\n"
-		case "system":
-			formattedText += "[::b]System::[-] " + msg.Content + "\n"
-		}
+	messages, labels := ms.getBranchLabels()
+	for _, msg := range messages {
+		formattedText += formatMessage(msg, labels[msg.ID], false, 0)
+	}
+	return formattedText
+}
+
+// formatMessage formats a single message inside a region named after its ID,
+// with the role and branch label on their own line and the content rendered as Markdown.
+func formatMessage(msg Message, label string, showMetadata bool, width int) string {
+	var role string
+	switch msg.Role {
+	case "user":
+		role = "User"
+	case "assistant":
+		role = "Assistant"
+	case "system":
+		role = "System"
+	}
+
+	formattedText := fmt.Sprintf("[\"%s\"][::b]%s%s::[-]%s\n%s[\"\"]\n", msg.ID, role, label, ratingLabel(msg.Rating), renderMarkdown(msg.Content, width))
+	if showMetadata {
+		formattedText += "[gray]  " + msg.metadata() + "[-]\n"
 	}
 	return formattedText
 }
@@ -74,7 +439,7 @@ func (ms *MessageStack) getFormattedText() string {
 // getPlainText returns the plain text representation of the messages.
 func (ms *MessageStack) getPlainText() string {
 	var plainText string
-	for _, msg := range ms.messages {
+	for _, msg := range ms.getAllMessages() {
 		switch msg.Role {
 		case "user":
 			plainText += "User: " + msg.Content + "\n"
@@ -87,23 +452,45 @@ func (ms *MessageStack) getPlainText() string {
 	return plainText
 }
 
-// clearMessagesByRole returns all messages in the stack with the specified role.
+// clearMessagesByRole removes all messages with the specified role from every
+// branch, attaching their replies to their parents, and returns the current branch.
 func (ms *MessageStack) clearMessagesByRole(role string) []Message {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	parents := make(map[string]string)
+	for _, msg := range ms.messages {
+		parents[msg.ID] = msg.ParentID
+	}
+	// Find the closest ancestor that is being kept
+	keptParent := func(id string) string {
+		for id != "" {
+			msg, ok := ms.message(id)
+			if !ok || msg.Role != role {
+				return id
+			}
+			id = parents[id]
+		}
+		return ""
+	}
+
 	var filteredMessages []Message
 	for _, msg := range ms.messages {
 		if msg.Role != role {
+			msg.ParentID = keptParent(msg.ParentID)
 			filteredMessages = append(filteredMessages, msg)
 		}
 	}
 
+	ms.head = keptParent(ms.head)
 	ms.messages = filteredMessages
-	return filteredMessages
+	ms.reindex()
+	return ms.branch()
 }
 
-// getMessagesByRole returns all messages in the stack with the specified role.
+// getMessagesByRole returns all messages on the current branch with the specified role.
 func (ms *MessageStack) getMessagesByRole(role string) []Message {
 	var filteredMessages []Message
-	for _, msg := range ms.messages {
+	for _, msg := range ms.getAllMessages() {
 		if msg.Role == role {
 			filteredMessages = append(filteredMessages, msg)
 		}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// contents returns the content of each message.
+func contents(messages []Message) []string {
+	var result []string
+	for _, msg := range messages {
+		result = append(result, msg.Content)
+	}
+	return result
+}
+
+// insert adds a message with a known ID to the current branch.
+func insert(ms *MessageStack, id, role, content string) {
+	ms.insertMessage(Message{ID: id, Role: role, Content: content})
+}
+
+func TestMessageStackBranches(t *testing.T) {
+	ms := &MessageStack{}
+	insert(ms, "s1", "system", "directive")
+	insert(ms, "u1", "user", "question")
+	insert(ms, "a1", "assistant", "first answer")
+
+	// Regenerating starts a sibling of the answer
+	if err := ms.branchFrom("a1"); err != nil {
+		t.Fatal(err)
+	}
+	insert(ms, "s2", "system", "directive again")
+	insert(ms, "a2", "assistant", "second answer")
+
+	if got, want := contents(ms.getAllMessages()), []string{"directive", "question", "directive again", "second answer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("branch is %q, want %q", got, want)
+	}
+	if got := contents(ms.getSiblings("a1")); !reflect.DeepEqual(got, []string{"first answer", "second answer"}) {
+		t.Errorf("siblings of a1 are %q", got)
+	}
+	if got := contents(ms.getSiblings("u1")); !reflect.DeepEqual(got, []string{"question"}) {
+		t.Errorf("siblings of u1 are %q", got)
+	}
+
+	messages, labels := ms.getBranchLabels()
+	if len(messages) != 4 || labels["a2"] != " (2/2)" || labels["u1"] != "" {
+		t.Errorf("labels are %q", labels)
+	}
+
+	sibling, err := ms.switchBranch("a2", -1)
+	if err != nil || sibling != "a1" || ms.getHead() != "a1" {
+		t.Errorf("switchBranch moved to %s, head %s (err %v)", sibling, ms.getHead(), err)
+	}
+	if _, err := ms.switchBranch("a1", -1); err == nil {
+		t.Error("switched past the first branch")
+	}
+
+	if err := ms.showMessage("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if ms.getHead() != "a2" {
+		t.Errorf("showMessage continued to %s, want the newest reply a2", ms.getHead())
+	}
+	if reply, ok := ms.lastReply(); !ok || reply.ID != "a2" {
+		t.Errorf("last reply is %v", reply)
+	}
+}
+
+func TestMessageStackSetTree(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []Message
+		head     string
+		branch   []string
+	}{
+		{"linear messages are chained", []Message{{ID: "1", Content: "a"}, {ID: "2", Content: "b"}}, "", []string{"a", "b"}},
+		{"head is kept", []Message{{ID: "1", Content: "a"}, {ID: "2", ParentID: "1", Content: "b"}, {ID: "3", ParentID: "1", Content: "c"}}, "2", []string{"a", "b"}},
+		{"unknown head follows the last message", []Message{{ID: "1", Content: "a"}, {ID: "2", ParentID: "1", Content: "b"}, {ID: "3", ParentID: "1", Content: "c"}}, "x", []string{"a", "c"}},
+		{"empty", nil, "", nil},
+	}
+	for _, tt := range tests {
+		ms := &MessageStack{}
+		ms.setTree(tt.messages, tt.head)
+		if got := contents(ms.getAllMessages()); !reflect.DeepEqual(got, tt.branch) {
+			t.Errorf("%s: branch is %q, want %q", tt.name, got, tt.branch)
+		}
+	}
+}
+
+func TestMessageStackClearMessagesByRole(t *testing.T) {
+	ms := &MessageStack{}
+	insert(ms, "s1", "system", "directive")
+	insert(ms, "u1", "user", "question")
+	insert(ms, "s2", "system", "file")
+	insert(ms, "a1", "assistant", "answer")
+
+	if got := contents(ms.clearMessagesByRole("system")); !reflect.DeepEqual(got, []string{"question", "answer"}) {
+		t.Errorf("branch is %q", got)
+	}
+	if msg, _ := ms.getMessage("a1"); msg.ParentID != "u1" {
+		t.Errorf("answer follows %q, want u1", msg.ParentID)
+	}
+	if _, ok := ms.getMessage("s2"); ok {
+		t.Error("system message is still there")
+	}
+}
+
+func TestMessageStackRateMessage(t *testing.T) {
+	ms := &MessageStack{}
+	insert(ms, "u1", "user", "question")
+	insert(ms, "a1", "assistant", "answer")
+
+	tests := []struct {
+		id, rating string
+		ok         bool
+	}{
+		{"a1", "good", true},
+		{"a1", "", true},
+		{"a1", "great", false},
+		{"u1", "bad", false},
+		{"x", "bad", false},
+	}
+	for _, tt := range tests {
+		if err := ms.rateMessage(tt.id, tt.rating); (err == nil) != tt.ok {
+			t.Errorf("rateMessage(%q, %q) returned %v", tt.id, tt.rating, err)
+		}
+	}
+}
+
+func TestMessageStackConcurrentUse(t *testing.T) {
+	ms := &MessageStack{}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			ms.insertUserMessage("question")
+			ms.insertAssistantMessage("answer")
+			ms.clearMessagesByRole("system")
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		ms.getBranchLabels()
+		ms.getTree()
+	}
+	wg.Wait()
+	if got := len(ms.getAllMessages()); got != 400 {
+		t.Errorf("branch has %d messages, want 400", got)
+	}
+}
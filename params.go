@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// File, relative to the project, with the parameters edited in AI Agents
+const agentParamsFile = ".pixelheat/agent-params.json"
+
+// Most stop sequences the API accepts
+const maxStopSequences = 4
+
+// paramNames are the generation parameters, as written in agent files and /params.
+var paramNames = []string{"temperature", "top_p", "max_tokens", "stop", "presence_penalty", "frequency_penalty", "seed"}
+
+// GenerationParams are the sampling settings sent with a completion. Nil
+// fields are left to the provider's defaults.
+type GenerationParams struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	MaxTokens        *int     `json:"max_tokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	JSONMode         bool     `json:"-"` // Ask the provider for a JSON object; only for services with JSONMode
+}
+
+// defaultGenerationParams are used by agents that don't set their own.
+func defaultGenerationParams() GenerationParams {
+	temperature := defaultTemperature
+	return GenerationParams{Temperature: &temperature}
+}
+
+// withTemperature returns params for a one-off call at the given temperature.
+func withTemperature(temperature float64) GenerationParams {
+	return GenerationParams{Temperature: &temperature}
+}
+
+// Merge returns p with every parameter set in over replacing its own.
+func (p GenerationParams) Merge(over GenerationParams) GenerationParams {
+	if over.Temperature != nil {
+		p.Temperature = over.Temperature
+	}
+	if over.TopP != nil {
+		p.TopP = over.TopP
+	}
+	if over.MaxTokens != nil {
+		p.MaxTokens = over.MaxTokens
+	}
+	if over.Stop != nil {
+		p.Stop = over.Stop
+	}
+	if over.PresencePenalty != nil {
+		p.PresencePenalty = over.PresencePenalty
+	}
+	if over.FrequencyPenalty != nil {
+		p.FrequencyPenalty = over.FrequencyPenalty
+	}
+	if over.Seed != nil {
+		p.Seed = over.Seed
+	}
+	p.JSONMode = p.JSONMode || over.JSONMode
+	return p
+}
+
+// IsZero reports whether no parameter is set.
+func (p GenerationParams) IsZero() bool {
+	return p.Temperature == nil && p.TopP == nil && p.MaxTokens == nil && len(p.Stop) == 0 &&
+		p.PresencePenalty == nil && p.FrequencyPenalty == nil && p.Seed == nil
+}
+
+// apply adds the parameters that are set to a request body.
+func (p GenerationParams) apply(data map[string]interface{}) {
+	if p.Temperature != nil {
+		data["temperature"] = *p.Temperature
+	}
+	if p.TopP != nil {
+		data["top_p"] = *p.TopP
+	}
+	if p.MaxTokens != nil {
+		data["max_tokens"] = *p.MaxTokens
+	}
+	if len(p.Stop) > 0 {
+		data["stop"] = p.Stop
+	}
+	if p.PresencePenalty != nil {
+		data["presence_penalty"] = *p.PresencePenalty
+	}
+	if p.FrequencyPenalty != nil {
+		data["frequency_penalty"] = *p.FrequencyPenalty
+	}
+	if p.Seed != nil {
+		data["seed"] = *p.Seed
+	}
+	if p.JSONMode {
+		data["response_format"] = map[string]string{"type": "json_object"}
+	}
+}
+
+// Get returns a parameter as text, or "" when it isn't set.
+func (p GenerationParams) Get(name string) string {
+	formatFloat := func(value *float64) string {
+		if value == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*value, 'f', -1, 64)
+	}
+	formatInt := func(value *int) string {
+		if value == nil {
+			return ""
+		}
+		return strconv.Itoa(*value)
+	}
+
+	switch name {
+	case "temperature":
+		return formatFloat(p.Temperature)
+	case "top_p":
+		return formatFloat(p.TopP)
+	case "max_tokens":
+		return formatInt(p.MaxTokens)
+	case "stop":
+		var stops []string
+		for _, stop := range p.Stop {
+			stops = append(stops, stopEscaper.Replace(stop))
+		}
+		return strings.Join(stops, ",")
+	case "presence_penalty":
+		return formatFloat(p.PresencePenalty)
+	case "frequency_penalty":
+		return formatFloat(p.FrequencyPenalty)
+	case "seed":
+		return formatInt(p.Seed)
+	}
+	return ""
+}
+
+// Set parses and sets a parameter; an empty value unsets it. Stop sequences
+// are separated by commas and may use \n for a newline, \, for a comma and
+// \\ for a backslash.
+func (p *GenerationParams) Set(name, value string) error {
+	value = strings.TrimSpace(value)
+	parseFloat := func(target **float64, min, max float64) error {
+		if value == "" {
+			*target = nil
+			return nil
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || number < min || number > max {
+			return fmt.Errorf("%s is %q, use a number from %g to %g", name, value, min, max)
+		}
+		*target = &number
+		return nil
+	}
+	parseInt := func(target **int, min int) error {
+		if value == "" {
+			*target = nil
+			return nil
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < min {
+			return fmt.Errorf("%s is %q, use a whole number of at least %d", name, value, min)
+		}
+		*target = &number
+		return nil
+	}
+
+	switch name {
+	case "temperature":
+		return parseFloat(&p.Temperature, 0, 2)
+	case "top_p":
+		return parseFloat(&p.TopP, 0, 1)
+	case "max_tokens":
+		return parseInt(&p.MaxTokens, 1)
+	case "stop":
+		return p.setStop(splitStops(value))
+	case "presence_penalty":
+		return parseFloat(&p.PresencePenalty, -2, 2)
+	case "frequency_penalty":
+		return parseFloat(&p.FrequencyPenalty, -2, 2)
+	case "seed":
+		return parseInt(&p.Seed, 0)
+	}
+	return fmt.Errorf("unknown parameter %q, use %s", name, strings.Join(paramNames, ", "))
+}
+
+// Escapes for the characters that can't be typed as is in a stop sequence
+var stopEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`)
+
+// splitStops splits comma separated stop sequences, undoing stopEscaper.
+func splitStops(value string) []string {
+	var stops []string
+	var stop strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			i++
+			if value[i] == 'n' {
+				stop.WriteByte('\n')
+			} else {
+				stop.WriteByte(value[i])
+			}
+		case value[i] == ',':
+			if stop.Len() > 0 {
+				stops = append(stops, stop.String())
+			}
+			stop.Reset()
+		default:
+			stop.WriteByte(value[i])
+		}
+	}
+	if stop.Len() > 0 {
+		stops = append(stops, stop.String())
+	}
+	return stops
+}
+
+// setStop sets the stop sequences, up to maxStopSequences of them.
+func (p *GenerationParams) setStop(stops []string) error {
+	if len(stops) > maxStopSequences {
+		return fmt.Errorf("stop has %d sequences, the most is %d", len(stops), maxStopSequences)
+	}
+	p.Stop = stops
+	return nil
+}
+
+// String lists the parameters that are set, like "temperature 0.2, seed 7".
+func (p GenerationParams) String() string {
+	var parts []string
+	for _, name := range paramNames {
+		if value := p.Get(name); value != "" {
+			parts = append(parts, name+" "+value)
+		}
+	}
+	if len(parts) == 0 {
+		return "provider defaults"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseParamAssignments reads "name=value" pairs, as typed after /params.
+func parseParamAssignments(args []string) (GenerationParams, error) {
+	var params GenerationParams
+	for _, arg := range args {
+		name, value, found := strings.Cut(arg, "=")
+		if !found {
+			return params, fmt.Errorf("expected name=value, got %q", arg)
+		}
+		if err := params.Set(name, value); err != nil {
+			return params, err
+		}
+	}
+	return params, nil
+}
+
+// loadParamOverrides reads the parameters edited in AI Agents, by agent name.
+func loadParamOverrides(projectDir string) (map[string]GenerationParams, error) {
+	overrides := make(map[string]GenerationParams)
+	data, err := os.ReadFile(filepath.Join(projectDir, agentParamsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return overrides, nil
+	}
+	if err != nil {
+		return overrides, err
+	}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return overrides, fmt.Errorf("reading %s: %w", agentParamsFile, err)
+	}
+	return overrides, nil
+}
+
+// saveParamOverrides writes the parameters edited in AI Agents.
+func saveParamOverrides(projectDir string, overrides map[string]GenerationParams) error {
+	path := filepath.Join(projectDir, agentParamsFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
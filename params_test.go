@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerationParamsSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		err   bool
+	}{
+		{"temperature", "0.2", "0.2", false},
+		{"temperature", "3", "", true},
+		{"temperature", "warm", "", true},
+		{"top_p", "1", "1", false},
+		{"max_tokens", "0", "", true},
+		{"max_tokens", " 256 ", "256", false},
+		{"seed", "7", "7", false},
+		{"presence_penalty", "-2", "-2", false},
+		{"stop", "END", "END", false},
+		{"stop", `a,,b\n`, `a,b\n`, false},
+		{"stop", `x\,y,z`, `x\,y,z`, false},
+		{"stop", `back\\slash`, `back\\slash`, false},
+		{"stop", "a,b,c,d,e", "", true},
+		{"color", "red", "", true},
+	}
+
+	for _, tt := range tests {
+		var params GenerationParams
+		err := params.Set(tt.name, tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("Set(%q, %q): got error %v, want error %v", tt.name, tt.value, err, tt.err)
+			continue
+		}
+		if got := params.Get(tt.name); got != tt.want {
+			t.Errorf("Set(%q, %q): got %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSplitStops(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"a,b", []string{"a", "b"}},
+		{`a\,b`, []string{"a,b"}},
+		{`line\n`, []string{"line\n"}},
+		{`a\\,b`, []string{`a\`, "b"}},
+		{`trailing\`, []string{`trailing\`}},
+	}
+
+	for _, tt := range tests {
+		if got := splitStops(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitStops(%q): got %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseParamAssignments(t *testing.T) {
+	params, err := parseParamAssignments([]string{"temperature=0.5", `stop=a\,b`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := params.String(); got != `temperature 0.5, stop a\,b` {
+		t.Errorf("got %q", got)
+	}
+	if !reflect.DeepEqual(params.Stop, []string{"a,b"}) {
+		t.Errorf("got stops %q", params.Stop)
+	}
+
+	if _, err := parseParamAssignments([]string{"temperature"}); err == nil {
+		t.Error("expected an error for a missing value")
+	}
+}
+
+func TestGenerationParamsMerge(t *testing.T) {
+	base := GenerationParams{Temperature: floatPtr(0.7), Stop: []string{"END"}}
+	merged := base.Merge(GenerationParams{Temperature: floatPtr(0.1), Seed: intPtr(3)})
+	if got := merged.String(); got != "temperature 0.1, stop END, seed 3" {
+		t.Errorf("got %q", got)
+	}
+	if *base.Temperature != 0.7 {
+		t.Error("Merge changed the receiver")
+	}
+}
+
+func floatPtr(value float64) *float64 { return &value }
+
+func intPtr(value int) *int { return &value }
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Directory, relative to the project, with the project's own pipelines
+const projectPipelinesDir = ".pixelheat/pipelines"
+
+// Most times a pipeline's steps can be repeated
+const maxPipelineRepeat = 10
+
+// Pipeline chains agents on one request, each step answering the output of
+// the one before with its own directive.
+type Pipeline struct {
+	Name     string
+	Steps    []string // Agent names, in the order they run
+	StopWhen string   // Stop early once a step's answer contains this text
+	Repeat   int      // Times the steps are run, unless stopped early
+	Source   string   // File the pipeline was defined in
+}
+
+// String describes the pipeline like "A > B > A until LGTM".
+func (p *Pipeline) String() string {
+	text := strings.Join(p.Steps, " > ")
+	if p.Repeat > 1 {
+		text += fmt.Sprintf(" (x%d)", p.Repeat)
+	}
+	if p.StopWhen != "" {
+		text += " until " + p.StopWhen
+	}
+	return text
+}
+
+// TotalSteps is the number of steps the pipeline runs unless stopped early.
+func (p *Pipeline) TotalSteps() int {
+	return len(p.Steps) * p.Repeat
+}
+
+// stopsAt reports whether an answer meets the pipeline's stop condition.
+func (p *Pipeline) stopsAt(response string) bool {
+	return p.StopWhen != "" && strings.Contains(strings.ToLower(response), strings.ToLower(p.StopWhen))
+}
+
+// pipelineHandoff is the prompt a step receives from the step before it.
+func pipelineHandoff(agent, response string) string {
+	return fmt.Sprintf("Output of %s:\n\n%s", agent, response)
+}
+
+// The loaded pipelines, replaced whenever the definition files change
+var (
+	pipelinesMu    sync.RWMutex
+	pipelines      []*Pipeline
+	pipelineErrors []error
+)
+
+// getPipelines returns the loaded pipelines.
+func getPipelines() []*Pipeline {
+	pipelinesMu.RLock()
+	defer pipelinesMu.RUnlock()
+	return pipelines
+}
+
+// getPipelineErrors returns the problems found in pipeline definition files.
+func getPipelineErrors() []error {
+	pipelinesMu.RLock()
+	defer pipelinesMu.RUnlock()
+	return pipelineErrors
+}
+
+// findPipeline returns the pipeline with the given name, or nil if there is none.
+func findPipeline(name string) *Pipeline {
+	for _, pipeline := range getPipelines() {
+		if strings.EqualFold(pipeline.Name, name) {
+			return pipeline
+		}
+	}
+	return nil
+}
+
+// pipelineDirs returns the directories pipeline definitions are read from, in
+// the order they override each other.
+func pipelineDirs(projectDir string) []string {
+	var dirs []string
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "pixelheat", "pipelines"))
+	}
+	return append(dirs, filepath.Join(projectDir, projectPipelinesDir))
+}
+
+// loadPipelines reads the pipelines in dirs. Invalid files are skipped and
+// reported; later definitions replace earlier ones with the same name.
+func loadPipelines(dirs []string) ([]*Pipeline, []error) {
+	var loaded []*Pipeline
+	var errs []error
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue // Pipeline directories are optional
+		}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			pipeline, err := parsePipeline(path, string(data))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			replaced := false
+			for i, existing := range loaded {
+				if existing.Name == pipeline.Name {
+					loaded[i] = pipeline
+					replaced = true
+				}
+			}
+			if !replaced {
+				loaded = append(loaded, pipeline)
+			}
+		}
+	}
+	return loaded, errs
+}
+
+// reloadPipelines replaces the loaded pipelines with those defined in dirs.
+func reloadPipelines(dirs []string) {
+	loaded, errs := loadPipelines(dirs)
+	pipelinesMu.Lock()
+	defer pipelinesMu.Unlock()
+	pipelines = loaded
+	pipelineErrors = errs
+}
+
+// parsePipeline reads a pipeline from YAML with the fields name, steps,
+// stop_when and repeat.
+func parsePipeline(path, content string) (*Pipeline, error) {
+	fields, err := parseConfigFields(strings.ReplaceAll(content, "\r\n", "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for key := range fields {
+		switch key {
+		case "name", "steps", "stop_when", "repeat":
+		default:
+			return nil, fmt.Errorf("%s: unknown field %q", path, key)
+		}
+	}
+
+	pipeline := &Pipeline{
+		Name:     strings.TrimSpace(fields["name"].Text),
+		Steps:    fields["steps"].Strings(),
+		StopWhen: fields["stop_when"].Text,
+		Repeat:   1,
+		Source:   path,
+	}
+	if pipeline.Name == "" {
+		return nil, fmt.Errorf("%s: name is required", path)
+	}
+	if value := fields["repeat"].Text; value != "" {
+		repeat, err := strconv.Atoi(value)
+		if err != nil || repeat < 1 || repeat > maxPipelineRepeat {
+			return nil, fmt.Errorf("%s: pipeline %q has repeat %q, use a number from 1 to %d", path, pipeline.Name, value, maxPipelineRepeat)
+		}
+		pipeline.Repeat = repeat
+	}
+	if err := pipeline.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pipeline, nil
+}
+
+// validate checks that the pipeline has steps and that each names an agent.
+func (p *Pipeline) validate() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("pipeline %q has no steps", p.Name)
+	}
+	for _, step := range p.Steps {
+		if findAIAgent(step) == nil {
+			return fmt.Errorf("pipeline %q uses unknown agent %q", p.Name, step)
+		}
+	}
+	return nil
+}
+
+// parsePipelineSpec builds an unnamed pipeline from "A > B > A until LGTM".
+func parsePipelineSpec(spec string) (*Pipeline, error) {
+	pipeline := &Pipeline{Name: "Pipeline", Repeat: 1}
+	if steps, stop, found := strings.Cut(spec, " until "); found {
+		spec = steps
+		pipeline.StopWhen = strings.TrimSpace(stop)
+	}
+	for _, step := range strings.Split(spec, ">") {
+		if step = strings.TrimSpace(step); step != "" {
+			pipeline.Steps = append(pipeline.Steps, step)
+		}
+	}
+	if err := pipeline.validate(); err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePipelineSpec(t *testing.T) {
+	reloadAgents(nil)
+	tests := []struct {
+		spec     string
+		steps    []string
+		stopWhen string
+		err      string
+	}{
+		{"PixelHeat > Code Reviewer (friendly)", []string{"PixelHeat", "Code Reviewer (friendly)"}, "", ""},
+		{"PixelHeat > Code Reviewer (friendly) > PixelHeat until LGTM", []string{"PixelHeat", "Code Reviewer (friendly)", "PixelHeat"}, "LGTM", ""},
+		{" PixelHeat >> Commit Writer ", []string{"PixelHeat", "Commit Writer"}, "", ""},
+		{"PixelHeat > Nobody", nil, "", `unknown agent "Nobody"`},
+		{" > ", nil, "", "has no steps"},
+		{"PixelHeat until", nil, "", `unknown agent "PixelHeat until"`},
+	}
+	for _, tt := range tests {
+		pipeline, err := parsePipelineSpec(tt.spec)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parsePipelineSpec(%q) returned error %v, want %q", tt.spec, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePipelineSpec(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(pipeline.Steps, tt.steps) || pipeline.StopWhen != tt.stopWhen || pipeline.Repeat != 1 {
+			t.Errorf("parsePipelineSpec(%q) = %+v", tt.spec, pipeline)
+		}
+	}
+}
+
+func TestParsePipeline(t *testing.T) {
+	reloadAgents(nil)
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		err     string
+	}{
+		{"full", "name: Review loop\nsteps: [PixelHeat, Code Reviewer (friendly)]\nstop_when: LGTM\nrepeat: 3\n", "PixelHeat > Code Reviewer (friendly) (x3) until LGTM", ""},
+		{"item list", "name: Commit\nsteps:\n  - PixelHeat\n  - Commit Writer\n", "PixelHeat > Commit Writer", ""},
+		{"no name", "steps: [PixelHeat]", "", "name is required"},
+		{"unknown field", "name: x\nsteps: [PixelHeat]\nloop: yes", "", `unknown field "loop"`},
+		{"repeat too high", "name: x\nsteps: [PixelHeat]\nrepeat: 11", "", "use a number from 1 to 10"},
+		{"repeat not a number", "name: x\nsteps: [PixelHeat]\nrepeat: twice", "", "use a number from 1 to 10"},
+	}
+	for _, tt := range tests {
+		pipeline, err := parsePipeline("p.yaml", tt.content)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := pipeline.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPipelineStopsAt(t *testing.T) {
+	pipeline := &Pipeline{StopWhen: "LGTM"}
+	if !pipeline.stopsAt("Looks fine, lgtm.") {
+		t.Error("stop condition is case sensitive")
+	}
+	if pipeline.stopsAt("Needs work") {
+		t.Error("stopped without the stop text")
+	}
+	if (&Pipeline{}).stopsAt("anything") {
+		t.Error("stopped without a stop condition")
+	}
+}
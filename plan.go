@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Plan is a step-by-step plan for a larger change, worked through one
+// approved step at a time.
+type Plan struct {
+	Goal  string     `json:"goal"`
+	Agent string     `json:"agent"` // Agent that made the plan and carries out its steps
+	Steps []PlanStep `json:"steps"`
+}
+
+// PlanStep is one item of a plan's checklist.
+type PlanStep struct {
+	Text string `json:"text"`
+	Done bool   `json:"done"`
+}
+
+// planSchema is the shape of the agent's plan.
+var planSchema = mustParseJSONSchema(`{
+  "type": "object",
+  "required": ["steps"],
+  "additionalProperties": false,
+  "properties": {
+    "steps": {
+      "type": "array",
+      "minItems": 1,
+      "items": {"type": "string", "minLength": 1}
+    }
+  }
+}`)
+
+// planPrompt asks for a plan over the attached files.
+func planPrompt(goal string) string {
+	return fmt.Sprintf("Before changing anything, plan this change over the attached files as a list of small steps, each one a change that can be made and checked on its own. Don't make the changes yet.\n\nChange: %s", goal)
+}
+
+// parsePlan reads the steps from the agent's answer, already validated against planSchema.
+func parsePlan(goal, agent, response string) (*Plan, error) {
+	var answer struct {
+		Steps []string `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(response), &answer); err != nil {
+		return nil, fmt.Errorf("could not parse plan: %w", err)
+	}
+	plan := &Plan{Goal: goal, Agent: agent}
+	for _, step := range answer.Steps {
+		plan.Steps = append(plan.Steps, PlanStep{Text: strings.TrimSpace(step)})
+	}
+	return plan, nil
+}
+
+// stepPrompt asks the agent to carry out one step of the plan.
+func (p *Plan) stepPrompt(index int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("We are working through this plan for: %s\n", p.Goal))
+	for i, step := range p.Steps {
+		mark := "[ ]"
+		if step.Done {
+			mark = "[x]"
+		}
+		sb.WriteString(fmt.Sprintf("%s %d. %s\n", mark, i+1, step.Text))
+	}
+	sb.WriteString(fmt.Sprintf("\nCarry out step %d only: %s\nGive the file edits for this step and stop; the next steps come later.", index+1, p.Steps[index].Text))
+	return sb.String()
+}
+
+// NextStep returns the index of the first step not done, or -1 when the plan is finished.
+func (p *Plan) NextStep() int {
+	for i, step := range p.Steps {
+		if !step.Done {
+			return i
+		}
+	}
+	return -1
+}
+
+// Move moves a step delta places up or down, returning its new index.
+func (p *Plan) Move(index, delta int) int {
+	target := index + delta
+	if index < 0 || index >= len(p.Steps) || target < 0 || target >= len(p.Steps) {
+		return index
+	}
+	p.Steps[index], p.Steps[target] = p.Steps[target], p.Steps[index]
+	return target
+}
+
+// Insert adds a step at index.
+func (p *Plan) Insert(index int, text string) {
+	if index < 0 || index > len(p.Steps) {
+		index = len(p.Steps)
+	}
+	p.Steps = append(p.Steps[:index], append([]PlanStep{{Text: text}}, p.Steps[index:]...)...)
+}
+
+// Remove deletes the step at index.
+func (p *Plan) Remove(index int) {
+	if index >= 0 && index < len(p.Steps) {
+		p.Steps = append(p.Steps[:index], p.Steps[index+1:]...)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stepTexts lists the text of a plan's steps.
+func stepTexts(plan *Plan) string {
+	var texts []string
+	for _, step := range plan.Steps {
+		texts = append(texts, step.Text)
+	}
+	return strings.Join(texts, " ")
+}
+
+func newTestPlan(texts ...string) *Plan {
+	plan := &Plan{Goal: "goal"}
+	for _, text := range texts {
+		plan.Steps = append(plan.Steps, PlanStep{Text: text})
+	}
+	return plan
+}
+
+func TestPlanEdits(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(plan *Plan) int
+		steps string
+		index int
+	}{
+		{"move down", func(p *Plan) int { return p.Move(0, 1) }, "b a c", 1},
+		{"move up", func(p *Plan) int { return p.Move(2, -1) }, "a c b", 1},
+		{"move past the top", func(p *Plan) int { return p.Move(0, -1) }, "a b c", 0},
+		{"move past the end", func(p *Plan) int { return p.Move(2, 1) }, "a b c", 2},
+		{"move missing step", func(p *Plan) int { return p.Move(5, -1) }, "a b c", 5},
+		{"insert first", func(p *Plan) int { p.Insert(0, "x"); return 0 }, "x a b c", 0},
+		{"insert middle", func(p *Plan) int { p.Insert(2, "x"); return 2 }, "a b x c", 2},
+		{"insert out of range appends", func(p *Plan) int { p.Insert(9, "x"); return 3 }, "a b c x", 3},
+		{"remove", func(p *Plan) int { p.Remove(1); return 1 }, "a c", 1},
+		{"remove missing step", func(p *Plan) int { p.Remove(3); return 3 }, "a b c", 3},
+	}
+
+	for _, tt := range tests {
+		plan := newTestPlan("a", "b", "c")
+		index := tt.edit(plan)
+		if got := stepTexts(plan); got != tt.steps || index != tt.index {
+			t.Errorf("%s: got %q at %d, want %q at %d", tt.name, got, index, tt.steps, tt.index)
+		}
+	}
+}
+
+func TestPlanNextStep(t *testing.T) {
+	plan := newTestPlan("a", "b")
+	if next := plan.NextStep(); next != 0 {
+		t.Errorf("got %d, want 0", next)
+	}
+	plan.Steps[0].Done = true
+	if next := plan.NextStep(); next != 1 {
+		t.Errorf("got %d, want 1", next)
+	}
+	plan.Steps[1].Done = true
+	if next := plan.NextStep(); next != -1 {
+		t.Errorf("got %d, want -1", next)
+	}
+}
+
+func TestParsePlan(t *testing.T) {
+	plan, err := parsePlan("goal", "Planner", `{"steps": [" first ", "second"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Agent != "Planner" || stepTexts(plan) != "first second" {
+		t.Errorf("got %+v", plan)
+	}
+	if _, err := parsePlan("goal", "Planner", `{"steps": "one"}`); err == nil {
+		t.Error("expected an error for steps that aren't a list")
+	}
+}
+
+func TestEditPlan(t *testing.T) {
+	core := &Core{projectDir: t.TempDir(), session: newSession(), stack: &MessageStack{}}
+	if err := core.EditPlan(func(plan *Plan) {}); err == nil {
+		t.Error("expected an error without a plan")
+	}
+
+	core.SetPlan(newTestPlan("a", "b"))
+	copied := core.GetPlan()
+	copied.Steps[0].Text = "changed"
+	if got := stepTexts(core.GetPlan()); got != "a b" {
+		t.Errorf("changing a copy changed the plan: %q", got)
+	}
+
+	// Edits and saves can run together without racing on the steps
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			core.EditPlan(func(plan *Plan) { plan.Insert(0, "x") })
+		}()
+		go func() {
+			defer wg.Done()
+			core.SaveSession()
+		}()
+	}
+	wg.Wait()
+	if got := len(core.GetPlan().Steps); got != 12 {
+		t.Errorf("got %d steps, want 12", got)
+	}
+
+	core.planRunning = true
+	if err := core.EditPlan(func(plan *Plan) { plan.Remove(0) }); err == nil {
+		t.Error("expected an error while a step runs")
+	}
+	if _, err := core.RunPlanStep(0); err == nil {
+		t.Error("expected an error running a second step")
+	}
+}
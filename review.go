@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Name of the agent that reviews diffs
+const reviewAgent = "Code Reviewer (friendly)"
+
+// reviewInstructions asks the reviewer for findings.
+const reviewInstructions = `Review the diff below. Lines of the new file are prefixed with their line number. Report each problem as a finding with its file, its line number in the new file, a severity and a message saying what is wrong and how to fix it. Report no findings if there is nothing to report.`
+
+// reviewSchema is the shape of the reviewer's answer.
+var reviewSchema = mustParseJSONSchema(`{
+  "type": "object",
+  "required": ["findings"],
+  "additionalProperties": false,
+  "properties": {
+    "findings": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["file", "line", "severity", "message"],
+        "additionalProperties": false,
+        "properties": {
+          "file": {"type": "string", "minLength": 1},
+          "line": {"type": "integer", "minimum": 1},
+          "severity": {"type": "string", "enum": ["error", "warning", "info"]},
+          "message": {"type": "string", "minLength": 1}
+        }
+      }
+    }
+  }
+}`)
+
+// ReviewFinding is a single issue raised by a code review.
+type ReviewFinding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// parseReviewFindings reads the findings from a reviewer's answer, already
+// validated against reviewSchema.
+func parseReviewFindings(response string) ([]ReviewFinding, error) {
+	var review struct {
+		Findings []ReviewFinding `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(response), &review); err != nil {
+		return nil, fmt.Errorf("could not parse findings: %w", err)
+	}
+	return review.Findings, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReviewFindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		findings []ReviewFinding
+		err      bool
+	}{
+		{"no findings", `{"findings": []}`, []ReviewFinding{}, false},
+		{"findings", `{"findings": [{"file": "a.go", "line": 4, "severity": "error", "message": "nil map"}, {"file": "b.go", "line": 1, "severity": "info", "message": "typo"}]}`, []ReviewFinding{
+			{File: "a.go", Line: 4, Severity: "error", Message: "nil map"},
+			{File: "b.go", Line: 1, Severity: "info", Message: "typo"},
+		}, false},
+		{"not JSON", `findings: none`, nil, true},
+		{"wrong shape", `{"findings": {"file": "a.go"}}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		findings, err := parseReviewFindings(tt.response)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(findings, tt.findings) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, findings, tt.findings)
+		}
+	}
+}
+
+func TestReviewSchema(t *testing.T) {
+	tests := []struct {
+		response string
+		problems int
+	}{
+		{`{"findings": [{"file": "a.go", "line": 4, "severity": "warning", "message": "m"}]}`, 0},
+		{`{"findings": [{"file": "a.go", "line": 0, "severity": "warning", "message": "m"}]}`, 1},
+		{`{"findings": [{"file": "a.go", "line": 2.5, "severity": "fatal", "message": "m"}]}`, 2},
+		{`{"findings": [{"file": "a.go"}]}`, 3},
+	}
+
+	for _, tt := range tests {
+		if _, problems := reviewSchema.Validate(tt.response); len(problems) != tt.problems {
+			t.Errorf("%s: got problems %q, want %d", tt.response, problems, tt.problems)
+		}
+	}
+}
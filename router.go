@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kinds of request the router tells apart
+const (
+	routeQuestion   = "question"
+	routeCodeChange = "code change"
+	routeReview     = "review"
+	routeCommit     = "commit message"
+	routeChat       = "chit-chat"
+)
+
+// routeCategories lists the kinds of request agents can declare in "routes".
+var routeCategories = []string{routeQuestion, routeCodeChange, routeReview, routeCommit, routeChat}
+
+// Ways of choosing the agent for a prompt
+const (
+	routingOff   = "off"   // First active agent, routing only by @mention or when none is active
+	routingRules = "rules" // Keyword rules
+	routingModel = "model" // A cheap model, falling back to the rules
+)
+
+// Model used to classify requests when routing by model
+const routerModel = "gpt-3.5-turbo"
+
+// routeRules are checked in order; the first match decides the category.
+var routeRules = []struct {
+	Category string
+	Pattern  *regexp.Regexp
+}{
+	{routeCommit, regexp.MustCompile(`(?i)\bcommit (message|msg)\b|\bwrite (a|the) commit\b|\bchangelog\b`)},
+	{routeReview, regexp.MustCompile(`(?i)\b(review|critique|feedback on|look over|any (issues|problems|bugs) (in|with))\b`)},
+	// Verbs only ask for a change at the start of a sentence, so "How do I fix X?" stays a question
+	{routeCodeChange, regexp.MustCompile(`(?i)(^|[.!;:]\s+)\s*(please\s+|(can|could|would|will) you\s+(please\s+)?|let's\s+)?(implement|refactor|fix|add|rename|change|update|remove|delete|write|create|convert|port|optimi[sz]e)\b`)},
+	{routeChat, regexp.MustCompile(`(?i)^\s*(hi|hello|hey|thanks|thank you|good (morning|afternoon|evening)|how are you|lol|cool|nice)\b[\s!.?]*$`)},
+	{routeQuestion, regexp.MustCompile(`(?i)\?\s*$|^\s*(what|why|how|when|where|which|who|can|could|does|do|is|are|should|explain)\b`)},
+}
+
+// RouteDecision is where the router sent a prompt and why.
+type RouteDecision struct {
+	Agent    *AIAgent
+	Category string
+	Reason   string
+	Prompt   string // The prompt without any @mention
+}
+
+// String describes the decision for the chat.
+func (d RouteDecision) String() string {
+	text := fmt.Sprintf("Routed to %s", d.Agent.Name)
+	if d.Category != "" {
+		text += fmt.Sprintf(" as a %s", d.Category)
+	}
+	return fmt.Sprintf("%s (%s). Start a prompt with @<agent> or press r on the answer to pick another agent", text, d.Reason)
+}
+
+// classifyByRules matches the input against routeRules, treating anything
+// unrecognised as a question.
+func classifyByRules(input string) (category, reason string) {
+	for _, rule := range routeRules {
+		if match := rule.Pattern.FindString(input); match != "" {
+			return rule.Category, fmt.Sprintf("matched %q", strings.Trim(match, " \t\n.!;:"))
+		}
+	}
+	return routeQuestion, "no rule matched"
+}
+
+// classifyByModel asks a cheap model for the category of the input.
+func classifyByModel(input string) (string, Usage, error) {
+	service := findService(routerModel)
+	if service == nil {
+		return "", Usage{}, fmt.Errorf("router model %s not found", routerModel)
+	}
+
+	stack := &MessageStack{}
+	stack.insertSystemMessage(fmt.Sprintf("Classify the user's request as exactly one of: %s. Answer with the category only.", strings.Join(routeCategories, ", ")))
+	stack.insertUserMessage(input)
+	answer, usage, err := requestChatCompletion(stack.getAllMessages(), service, withTemperature(0))
+	if err != nil {
+		return "", usage, err
+	}
+	recordUsage(service, usage)
+
+	answer = strings.ToLower(strings.Trim(strings.TrimSpace(answer), ".\"'"))
+	for _, category := range routeCategories {
+		if strings.Contains(answer, category) {
+			return category, usage, nil
+		}
+	}
+	return "", usage, fmt.Errorf("router answered %q", answer)
+}
+
+// routeAgent returns the agent for a category, preferring active agents over
+// other loaded ones, or nil if no agent handles it.
+func routeAgent(category string, active []*AIAgentNode) *AIAgent {
+	for _, node := range active {
+		if contains(node.AIAgent.Routes, category) {
+			return node.AIAgent
+		}
+	}
+	for _, agent := range getAIAgents() {
+		if contains(agent.Routes, category) {
+			return agent
+		}
+	}
+	return nil
+}
+
+// mentionedAgent returns the agent named after an @ at the start of the
+// input, like "@Code Reviewer (friendly) look at this", and the rest of it.
+func mentionedAgent(input string) (*AIAgent, string) {
+	trimmed := strings.TrimSpace(input)
+	if !strings.HasPrefix(trimmed, "@") {
+		return nil, input
+	}
+	trimmed = trimmed[1:]
+
+	// Names contain spaces, so take the longest that matches a whole name
+	var best *AIAgent
+	for _, agent := range getAIAgents() {
+		if len(trimmed) >= len(agent.Name) && strings.EqualFold(trimmed[:len(agent.Name)], agent.Name) &&
+			endsWord(trimmed[len(agent.Name):]) && (best == nil || len(agent.Name) > len(best.Name)) {
+			best = agent
+		}
+	}
+	if best == nil {
+		return nil, input
+	}
+	return best, strings.TrimSpace(trimmed[len(best.Name):])
+}
+
+// endsWord reports whether rest can follow a name: nothing, or a character
+// that isn't part of a word, so "@PixelHeatX" doesn't mention PixelHeat.
+func endsWord(rest string) bool {
+	r, _ := utf8.DecodeRuneInString(rest)
+	return rest == "" || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestClassifyByRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		category string
+	}{
+		{"Write a commit message for the staged changes", routeCommit},
+		{"Update the changelog", routeCommit},
+		{"Please review the parser", routeReview},
+		{"Any bugs in this function?", routeReview},
+		{"Fix the crash when the file is empty", routeCodeChange},
+		{"please add a --verbose flag", routeCodeChange},
+		{"Can you rename Foo to Bar?", routeCodeChange},
+		{"The tests fail. Fix them", routeCodeChange},
+		{"How do I fix the build?", routeQuestion},
+		{"What does update do?", routeQuestion},
+		{"Why would anyone write it like this", routeQuestion},
+		{"The prefix handling is confusing", routeQuestion},
+		{"thanks!", routeChat},
+		{"hello", routeChat},
+	}
+	for _, tt := range tests {
+		if category, reason := classifyByRules(tt.input); category != tt.category {
+			t.Errorf("classifyByRules(%q) = %q (%s), want %q", tt.input, category, reason, tt.category)
+		}
+	}
+}
+
+func TestMentionedAgent(t *testing.T) {
+	reloadAgents(nil)
+	tests := []struct {
+		input  string
+		agent  string
+		prompt string
+	}{
+		{"@PixelHeat add a flag", "PixelHeat", "add a flag"},
+		{"@pixelheat (pirate) say hi", "PixelHeat (Pirate)", "say hi"},
+		{"  @Code Reviewer (friendly): look at this", "Code Reviewer (friendly)", ": look at this"},
+		{"@PixelHeat", "PixelHeat", ""},
+		{"@PixelHeatX add a flag", "", "@PixelHeatX add a flag"},
+		{"@Nobody hi", "", "@Nobody hi"},
+		{"email me@PixelHeat", "", "email me@PixelHeat"},
+	}
+	for _, tt := range tests {
+		agent, prompt := mentionedAgent(tt.input)
+		name := ""
+		if agent != nil {
+			name = agent.Name
+		}
+		if name != tt.agent || prompt != tt.prompt {
+			t.Errorf("mentionedAgent(%q) = %q, %q, want %q, %q", tt.input, name, prompt, tt.agent, tt.prompt)
+		}
+	}
+}
+
+func TestRouteAgentPrefersActiveAgents(t *testing.T) {
+	reloadAgents(nil)
+	pirate := findAIAgent("PixelHeat (Pirate)")
+	pirate.Routes = []string{routeCodeChange}
+	defer func() { pirate.Routes = nil }()
+
+	if agent := routeAgent(routeCodeChange, nil); agent == nil || agent.Name != "PixelHeat" {
+		t.Errorf("with no active agents routed to %v, want PixelHeat", agent)
+	}
+	active := []*AIAgentNode{{Name: pirate.Name, AIAgent: pirate, Active: true}}
+	if agent := routeAgent(routeCodeChange, active); agent != pirate {
+		t.Errorf("routed to %v, want the active %s", agent, pirate.Name)
+	}
+}
+
+func TestRouteFallsBackToRulesWhenTheModelFails(t *testing.T) {
+	reloadAgents(nil)
+	serveCompletions(t, http.StatusUnauthorized, `{"error":"no key"}`)
+	core := &Core{session: newSession(), routing: routingModel}
+
+	decision, err := core.Route("please implement the export button")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Category != routeCodeChange || strings.HasPrefix(decision.Reason, "classified by") {
+		t.Errorf("got %s (%s), want the %s rule", decision.Category, decision.Reason, routeCodeChange)
+	}
+}
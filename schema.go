@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Times a model is asked for JSON before giving up on a reply that doesn't validate
+const maxJSONAttempts = 3
+
+// JSONSchema is a JSON Schema. Only the keywords agents' answers need are
+// checked: type, properties, required, additionalProperties, items, enum,
+// minItems, maxItems, minLength, minimum and maximum.
+type JSONSchema struct {
+	Text   string // The schema as given, shown to the model
+	schema map[string]interface{}
+}
+
+// parseJSONSchema reads a schema from its JSON text.
+func parseJSONSchema(text string) (*JSONSchema, error) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return &JSONSchema{Text: text, schema: schema}, nil
+}
+
+// mustParseJSONSchema parses a schema built into PixelHeat.
+func mustParseJSONSchema(text string) *JSONSchema {
+	schema, err := parseJSONSchema(text)
+	checkError(err, "Error parsing built-in schema")
+	return schema
+}
+
+// IsObject reports whether the schema describes an object, the only kind of
+// answer providers' JSON modes produce.
+func (s *JSONSchema) IsObject() bool {
+	return s.schema["type"] == "object"
+}
+
+// Instructions asks a model to answer with JSON matching the schema.
+func (s *JSONSchema) Instructions() string {
+	return "Respond with only JSON, without code fences or any other text, that matches this JSON Schema:\n" + s.Text
+}
+
+// Validate parses a reply and checks it against the schema, returning the
+// JSON and every problem found.
+func (s *JSONSchema) Validate(reply string) (string, []string) {
+	text := extractJSON(reply)
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return text, []string{fmt.Sprintf("the answer is not valid JSON: %v", err)}
+	}
+	return text, validateJSONValue(s.schema, value, "$")
+}
+
+// extractJSON drops code fences and any text around the outermost JSON value.
+func extractJSON(reply string) string {
+	reply = strings.TrimSpace(reply)
+	start := strings.IndexAny(reply, "{[")
+	if start < 0 {
+		return reply
+	}
+	closing := "}"
+	if reply[start] == '[' {
+		closing = "]"
+	}
+	end := strings.LastIndex(reply, closing)
+	if end < start {
+		return reply
+	}
+	return reply[start : end+1]
+}
+
+// validateJSONValue checks a decoded value against a schema, naming problems by path.
+func validateJSONValue(schema map[string]interface{}, value interface{}, path string) []string {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, name := range types {
+			if jsonTypeIs(value, name) {
+				matched = true
+			}
+		}
+		if !matched {
+			fail("expected %s, got %s", strings.Join(types, " or "), jsonTypeName(value))
+			return problems
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			if fmt.Sprint(option) == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			encoded, _ := json.Marshal(enum)
+			fail("must be one of %s", encoded)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, present := v[fmt.Sprint(name)]; !present {
+					fail("missing required property %q", name)
+				}
+			}
+		}
+		// Sort the keys so problems come out in the same order every time
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := properties[key].(map[string]interface{}); ok {
+				problems = append(problems, validateJSONValue(property, v[key], path+"."+key)...)
+			} else if schema["additionalProperties"] == false {
+				fail("unexpected property %q", key)
+			}
+		}
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			fail("expected at least %g items, got %d", min, len(v))
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			fail("expected at most %g items, got %d", max, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateJSONValue(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		if min, ok := schema["minLength"].(float64); ok && float64(len([]rune(v))) < min {
+			fail("expected at least %g characters", min)
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			fail("must be at least %g", min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			fail("must be at most %g", max)
+		}
+	}
+	return problems
+}
+
+// schemaTypes returns the types a schema allows, given as a name or a list.
+func schemaTypes(value interface{}) []string {
+	switch t := value.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, name := range t {
+			types = append(types, fmt.Sprint(name))
+		}
+		return types
+	}
+	return nil
+}
+
+// jsonTypeIs reports whether a decoded value has the named JSON Schema type.
+func jsonTypeIs(value interface{}, name string) bool {
+	switch name {
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return jsonTypeName(value) == name
+}
+
+// jsonTypeName names the JSON type of a decoded value.
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// completeJSON asks for an answer matching schema, using the service's JSON
+// mode when it has one, and asks again with the problems found until the
+// answer validates or maxJSONAttempts is reached. It returns the JSON and the
+// usage of every attempt, or the error of a request that failed.
+func completeJSON(messages []Message, service *Service, params GenerationParams, schema *JSONSchema) (string, Usage, error) {
+	messages = append(append([]Message(nil), messages...), Message{Role: "system", Content: schema.Instructions()})
+	params.JSONMode = service.JSONMode && schema.IsObject()
+
+	var total Usage
+	var problems []string
+	for attempt := 1; attempt <= maxJSONAttempts; attempt++ {
+		reply, usage, err := requestChatCompletion(messages, service, params)
+		if err != nil {
+			return "", total, err
+		}
+		recordUsage(service, usage)
+		total.InputTokens += usage.InputTokens
+		total.OutputTokens += usage.OutputTokens
+		total.Cost += usage.Cost
+
+		var text string
+		if text, problems = schema.Validate(reply); len(problems) == 0 {
+			return text, total, nil
+		}
+		messages = append(messages,
+			Message{Role: "assistant", Content: reply},
+			Message{Role: "user", Content: "That answer does not match the schema:\n- " + strings.Join(problems, "\n- ") + "\nAnswer again with only the corrected JSON."},
+		)
+	}
+	return "", total, fmt.Errorf("no valid JSON after %d attempts: %s", maxJSONAttempts, strings.Join(problems, "; "))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{`{"a":1}`, `{"a":1}`},
+		{"```json\n{\"a\":1}\n```", `{"a":1}`},
+		{`Here it is: [1,2] as asked.`, `[1,2]`},
+		{`{"a":{"b":2}} done`, `{"a":{"b":2}}`},
+		{`no json`, `no json`},
+		{`} {`, `} {`},
+	}
+
+	for _, tt := range tests {
+		if got := extractJSON(tt.reply); got != tt.want {
+			t.Errorf("extractJSON(%q): got %q, want %q", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestValidateJSONValue(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"required": ["name", "steps"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 2},
+			"level": {"enum": ["low", "high"]},
+			"score": {"type": "number", "minimum": 0, "maximum": 10},
+			"count": {"type": ["integer", "null"]},
+			"steps": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string"}}
+		}
+	}`
+	tests := []struct {
+		value    string
+		problems []string
+	}{
+		{`{"name":"ok","steps":["a"]}`, nil},
+		{`{"name":"ok","steps":["a"],"level":"high","score":10,"count":null}`, nil},
+		{`[]`, []string{"$: expected object, got array"}},
+		{`{"steps":["a"]}`, []string{`$: missing required property "name"`}},
+		{`{"name":"x","steps":["a"]}`, []string{"$.name: expected at least 2 characters"}},
+		{`{"name":"ok","steps":[]}`, []string{"$.steps: expected at least 1 items, got 0"}},
+		{`{"name":"ok","steps":["a","b","c"]}`, []string{"$.steps: expected at most 2 items, got 3"}},
+		{`{"name":"ok","steps":["a",2]}`, []string{"$.steps[1]: expected string, got number"}},
+		{`{"name":"ok","steps":["a"],"level":"mid"}`, []string{`$.level: must be one of ["low","high"]`}},
+		{`{"name":"ok","steps":["a"],"score":11}`, []string{"$.score: must be at most 10"}},
+		{`{"name":"ok","steps":["a"],"count":1.5}`, []string{"$.count: expected integer or null, got number"}},
+		{`{"name":"ok","steps":["a"],"extra":true}`, []string{`$: unexpected property "extra"`}},
+	}
+
+	parsed := mustParseJSONSchema(schema)
+	for _, tt := range tests {
+		var value interface{}
+		if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+			t.Fatal(err)
+		}
+		problems := validateJSONValue(parsed.schema, value, "$")
+		if strings.Join(problems, "\n") != strings.Join(tt.problems, "\n") {
+			t.Errorf("%s: got %q, want %q", tt.value, problems, tt.problems)
+		}
+	}
+}
+
+func TestJSONSchemaValidate(t *testing.T) {
+	schema := mustParseJSONSchema(`{"type": "object", "required": ["a"]}`)
+	if text, problems := schema.Validate("```\n{\"a\": 1}\n```"); len(problems) > 0 || text != `{"a": 1}` {
+		t.Errorf("got %q %q", text, problems)
+	}
+	if _, problems := schema.Validate("{a: 1}"); len(problems) != 1 || !strings.Contains(problems[0], "not valid JSON") {
+		t.Errorf("got %q", problems)
+	}
+	if _, err := parseJSONSchema("{"); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+}
+
+func TestHandleInputJSONFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    string
+	}{
+		{"invalid answers", http.StatusOK, `{"choices":[{"message":{"content":"{}"}}]}`, "no valid JSON after 3 attempts"},
+		{"request error", http.StatusInternalServerError, `{"error":"down"}`, "received 500 status"},
+	}
+
+	schema := mustParseJSONSchema(`{"type": "object", "required": ["a"]}`)
+	for _, tt := range tests {
+		serveCompletions(t, tt.status, tt.body)
+		agent := &AIAgent{Name: "Tester", Services: []*Service{{ModelName: "test"}}}
+		core := &Core{projectDir: t.TempDir(), session: newSession()}
+		stack := &MessageStack{}
+
+		_, err := agent.HandleInputJSON("question", stack, core, schema)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+		reply, ok := stack.lastReply()
+		if !ok || !strings.HasPrefix(reply.Content, "Could not get an answer matching the schema") {
+			t.Errorf("%s: the question was left without an error reply, got %+v", tt.name, reply)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// File, relative to the project, holding the search index of saved sessions
+const searchIndexFile = ".pixelheat/search-index.json"
+
+// Results shown for a search
+const maxSearchResults = 100
+
+// searchDoc is an indexed message of a saved session.
+type searchDoc struct {
+	Session     string    `json:"session"`
+	SessionName string    `json:"session_name"`
+	Message     string    `json:"message"`
+	Role        string    `json:"role"`
+	Agent       string    `json:"agent,omitempty"`
+	Time        time.Time `json:"time"`
+	Text        string    `json:"text"`
+}
+
+// searchIndex is an inverted index over the messages of all saved sessions.
+// Only the documents are stored; the term lists are rebuilt when loading.
+type searchIndex struct {
+	Sessions map[string]time.Time `json:"sessions"` // When each indexed session was last updated
+	Docs     []searchDoc          `json:"docs"`
+
+	terms map[string][]int // Term to the documents containing it
+}
+
+// SearchResult is a message matching a query.
+type SearchResult struct {
+	Doc     searchDoc
+	Score   int
+	Preview string
+}
+
+// searchTerms splits text into lower case words.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// loadSearchIndex reads the index from disk, or returns an empty one.
+func loadSearchIndex(projectDir string) *searchIndex {
+	index := &searchIndex{Sessions: make(map[string]time.Time)}
+	data, err := os.ReadFile(filepath.Join(projectDir, searchIndexFile))
+	if err == nil {
+		if err := json.Unmarshal(data, index); err != nil {
+			// A broken index is only a cache, start over
+			index = &searchIndex{Sessions: make(map[string]time.Time)}
+		}
+	}
+	if index.Sessions == nil {
+		index.Sessions = make(map[string]time.Time)
+	}
+	return index
+}
+
+// save writes the index to disk.
+func (index *searchIndex) save(projectDir string) error {
+	path := filepath.Join(projectDir, searchIndexFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// updateSearchIndex reindexes sessions that changed since the index was
+// written, drops deleted ones and returns the index ready for queries.
+func updateSearchIndex(projectDir string) (*searchIndex, error) {
+	index := loadSearchIndex(projectDir)
+	sessions, err := listSessions(projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]*Session)
+	for _, session := range sessions {
+		current[session.ID] = session
+	}
+
+	// Keep the documents of sessions that are unchanged
+	changed := false
+	var docs []searchDoc
+	for _, doc := range index.Docs {
+		session, ok := current[doc.Session]
+		if ok && index.Sessions[doc.Session].Equal(session.Updated) {
+			docs = append(docs, doc)
+		} else {
+			changed = true
+		}
+	}
+	for id := range index.Sessions {
+		if _, ok := current[id]; !ok {
+			delete(index.Sessions, id)
+			changed = true
+		}
+	}
+
+	for _, session := range sessions {
+		if updated, ok := index.Sessions[session.ID]; ok && updated.Equal(session.Updated) {
+			continue
+		}
+		for _, msg := range session.Messages {
+			// Directives and file contents would match nearly every search
+			if msg.Role == "system" {
+				continue
+			}
+			docs = append(docs, searchDoc{
+				Session:     session.ID,
+				SessionName: session.Name,
+				Message:     msg.ID,
+				Role:        msg.Role,
+				Agent:       msg.Agent,
+				Time:        msg.Time,
+				Text:        msg.Content,
+			})
+		}
+		index.Sessions[session.ID] = session.Updated
+		changed = true
+	}
+
+	index.Docs = docs
+	if changed {
+		if err := index.save(projectDir); err != nil {
+			return nil, err
+		}
+	}
+	index.build()
+	return index, nil
+}
+
+// build fills in the term lists from the documents.
+func (index *searchIndex) build() {
+	index.terms = make(map[string][]int)
+	for i, doc := range index.Docs {
+		seen := make(map[string]bool)
+		for _, term := range searchTerms(doc.Text) {
+			if !seen[term] {
+				seen[term] = true
+				index.terms[term] = append(index.terms[term], i)
+			}
+		}
+	}
+}
+
+// searchQuery is a parsed query: words that must all appear, plus filters.
+type searchQuery struct {
+	Words  []string
+	Role   string
+	Agent  string
+	After  time.Time
+	Before time.Time
+}
+
+// parseSearchQuery understands plain words and the filters role:, agent:,
+// after: and before: (dates as YYYY-MM-DD).
+func parseSearchQuery(input string) (searchQuery, error) {
+	var query searchQuery
+	for _, field := range strings.Fields(input) {
+		key, value, found := strings.Cut(field, ":")
+		if !found || value == "" {
+			query.Words = append(query.Words, searchTerms(field)...)
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "role":
+			query.Role = strings.ToLower(value)
+		case "agent":
+			query.Agent = strings.ToLower(value)
+		case "after":
+			query.After, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		case "before":
+			query.Before, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		default:
+			query.Words = append(query.Words, searchTerms(field)...)
+		}
+		if err != nil {
+			return query, fmt.Errorf("invalid date in %q, use YYYY-MM-DD", field)
+		}
+	}
+	if len(query.Words) == 0 && query.Role == "" && query.Agent == "" && query.After.IsZero() && query.Before.IsZero() {
+		return query, fmt.Errorf("nothing to search for")
+	}
+	return query, nil
+}
+
+// matches reports whether a document passes the query's filters.
+func (query searchQuery) matches(doc searchDoc) bool {
+	if query.Role != "" && doc.Role != query.Role {
+		return false
+	}
+	if query.Agent != "" && !strings.Contains(strings.ToLower(doc.Agent), query.Agent) {
+		return false
+	}
+	if !query.After.IsZero() && doc.Time.Before(query.After) {
+		return false
+	}
+	if !query.Before.IsZero() && !doc.Time.Before(query.Before) {
+		return false
+	}
+	return true
+}
+
+// search returns the messages containing every word of the query, best matches first.
+func (index *searchIndex) search(input string) ([]SearchResult, error) {
+	query, err := parseSearchQuery(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start from the documents of the first word and intersect the rest
+	var candidates []int
+	if len(query.Words) == 0 {
+		for i := range index.Docs {
+			candidates = append(candidates, i)
+		}
+	} else {
+		candidates = index.terms[query.Words[0]]
+		for _, word := range query.Words[1:] {
+			has := make(map[int]bool)
+			for _, i := range index.terms[word] {
+				has[i] = true
+			}
+			var both []int
+			for _, i := range candidates {
+				if has[i] {
+					both = append(both, i)
+				}
+			}
+			candidates = both
+		}
+	}
+
+	var results []SearchResult
+	for _, i := range candidates {
+		doc := index.Docs[i]
+		if !query.matches(doc) {
+			continue
+		}
+		score := 0
+		for _, term := range searchTerms(doc.Text) {
+			if contains(query.Words, term) {
+				score++
+			}
+		}
+		results = append(results, SearchResult{Doc: doc, Score: score, Preview: searchPreview(doc.Text, query.Words)})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Doc.Time.After(results[j].Doc.Time)
+	})
+	if len(results) > maxSearchResults {
+		results = results[:maxSearchResults]
+	}
+	return results, nil
+}
+
+// searchPreview returns the line around the first match on one line.
+func searchPreview(text string, words []string) string {
+	const width = 100
+	flat := strings.Join(strings.Fields(text), " ")
+	lower := strings.ToLower(flat)
+
+	start := 0
+	for _, word := range words {
+		if i := strings.Index(lower, word); i >= 0 {
+			start = i - width/3
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	// Move to a rune boundary so multi-byte characters are not split
+	for start > 0 && start < len(flat) && !utf8.RuneStart(flat[start]) {
+		start--
+	}
+
+	preview := flat[start:]
+	if len(preview) > width {
+		end := width
+		for end > 0 && !utf8.RuneStart(preview[end]) {
+			end--
+		}
+		preview = preview[:end] + "..."
+	}
+	if start > 0 {
+		preview = "..." + preview
+	}
+	return preview
+}
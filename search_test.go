@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", s, time.Local)
+		return d
+	}
+	tests := []struct {
+		input string
+		want  searchQuery
+		ok    bool
+	}{
+		{"Fix the Parser", searchQuery{Words: []string{"fix", "the", "parser"}}, true},
+		{"role:Assistant agent:Pixel goroutine", searchQuery{Words: []string{"goroutine"}, Role: "assistant", Agent: "pixel"}, true},
+		{"after:2026-01-02 before:2026-02-01", searchQuery{After: day("2026-01-02"), Before: day("2026-02-01")}, true},
+		{"http://example.com", searchQuery{Words: []string{"http", "example", "com"}}, true},
+		{"note: done", searchQuery{Words: []string{"note", "done"}}, true},
+		{"after:yesterday", searchQuery{}, false},
+		{"", searchQuery{}, false},
+		{"  ", searchQuery{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSearchQuery(tt.input)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseSearchQuery(%q) returned %v", tt.input, err)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	now := time.Now()
+	index := &searchIndex{Docs: []searchDoc{
+		{Message: "1", Role: "user", Text: "How do I fix the parser?", Time: now.Add(-time.Hour)},
+		{Message: "2", Role: "assistant", Agent: "PixelHeat", Text: "Fix the parser by fixing the parser's lexer.", Time: now},
+		{Message: "3", Role: "assistant", Agent: "Reviewer", Text: "The lexer looks fine.", Time: now},
+	}}
+	index.build()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"parser", []string{"2", "1"}},
+		{"fix parser", []string{"2", "1"}},
+		{"lexer role:assistant", []string{"2", "3"}},
+		{"lexer agent:review", []string{"3"}},
+		{"parser role:user", []string{"1"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		results, err := index.search(tt.query)
+		if err != nil {
+			t.Errorf("search(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, result := range results {
+			got = append(got, result.Doc.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search(%q) found %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
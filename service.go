@@ -1,6 +1,8 @@
 // Package main provides a collection of models and services for natural language processing.
 package main
 
+import "strings"
+
 // Service represents a natural language processing service.
 type Service struct {
 	ModelName    string  // The name of the model used for the service.
@@ -10,6 +12,7 @@ type Service struct {
 	TrainingCost float64 // The cost of training the model for the service. Only applicable for fine-tuning models.
 	InputTokens  int     // Total tokens processed for inputs
 	OutputTokens int     // Total tokens processed for outputs
+	JSONMode     bool    // Whether the model can be told to answer with a JSON object
 }
 
 // ModelType represents a type of natural language processing model.
@@ -24,6 +27,7 @@ var models = []ModelType{
 		Name: "gpt-4",
 		Services: []*Service{
 			{ModelName: "gpt-4", Context: 8192, InputCost: 0.03, OutputCost: 0.06},
+			{ModelName: "gpt-4-1106-preview", Context: 128000, InputCost: 0.01, OutputCost: 0.03, JSONMode: true},
 			{ModelName: "gpt-4-0613", Context: 8192, InputCost: 0.03, OutputCost: 0.06},
 			{ModelName: "gpt-4-32k", Context: 32768, InputCost: 0.06, OutputCost: 0.12},
 			{ModelName: "gpt-4-32k-0613", Context: 32768, InputCost: 0.06, OutputCost: 0.12},
@@ -35,6 +39,7 @@ var models = []ModelType{
 		Name: "gpt-3.5",
 		Services: []*Service{
 			{ModelName: "gpt-3.5-turbo", Context: 4096, InputCost: 0.0015, OutputCost: 0.002},
+			{ModelName: "gpt-3.5-turbo-1106", Context: 16385, InputCost: 0.001, OutputCost: 0.002, JSONMode: true},
 			{ModelName: "gpt-3.5-turbo-16k", Context: 16384, InputCost: 0.003, OutputCost: 0.004},
 			{ModelName: "gpt-3.5-turbo-0613", Context: 4096, InputCost: 0.0015, OutputCost: 0.002},
 			{ModelName: "gpt-3.5-turbo-16k-0613", Context: 16384, InputCost: 0.003, OutputCost: 0.004},
@@ -88,3 +93,38 @@ func GetService(modelName, context string) *Service {
 	}
 	return nil // Return nil if the model or context is not found
 }
+
+// findService returns the service with the given model name from any model type.
+func findService(modelName string) *Service {
+	for _, model := range models {
+		for _, service := range model.Services {
+			if service.ModelName == modelName {
+				return service
+			}
+		}
+	}
+	return nil
+}
+
+// chatServices returns the current services that can answer chat requests.
+func chatServices() []*Service {
+	var services []*Service
+	for _, model := range models {
+		for _, service := range model.Services {
+			// Fine-tuning and embedding models have no context size, legacy ones are retired
+			if service.Context > 0 && !strings.HasSuffix(service.ModelName, "(Legacy)") {
+				services = append(services, service)
+			}
+		}
+	}
+	return services
+}
+
+// serviceNames returns the model names of services.
+func serviceNames(services []*Service) []string {
+	var names []string
+	for _, service := range services {
+		names = append(names, service.ModelName)
+	}
+	return names
+}
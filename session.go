@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Directory, relative to the project, where sessions are saved
+const sessionsDir = ".pixelheat/sessions"
+
+// Turn records which service answered a request and what it cost.
+type Turn struct {
+	Time    time.Time `json:"time"`
+	Agent   string    `json:"agent"`
+	Service string    `json:"service"`
+	Cost    float64   `json:"cost"`
+}
+
+// Session is a conversation that is saved to disk after every turn.
+type Session struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+	Messages     []Message `json:"messages"` // Every message of every branch
+	Head         string    `json:"head"`     // Last message of the current branch
+	ActiveAgents []string  `json:"active_agents"`
+	ActiveFiles  []string  `json:"active_files"`
+	Turns        []Turn    `json:"turns"`
+	Plan         *Plan     `json:"plan,omitempty"` // Plan being worked through, if any
+}
+
+// newSession creates an empty session named after the current time. A random
+// suffix keeps sessions started within the same second apart.
+func newSession() *Session {
+	now := time.Now()
+	stamp := now.Format("20060102-150405")
+	id := stamp + "-" + newMessageID()[:6]
+	return &Session{ID: id, Name: "session-" + stamp, Created: now, Updated: now}
+}
+
+// Cost returns the total cost of the session's turns.
+func (s *Session) Cost() float64 {
+	total := 0.0
+	for _, turn := range s.Turns {
+		total += turn.Cost
+	}
+	return total
+}
+
+// Summary describes the session in one line for pickers and listings.
+func (s *Session) Summary() string {
+	return fmt.Sprintf("%s (%s, %d messages, $%.2f)", s.Name, s.Updated.Format("2006-01-02 15:04"), len(s.Messages), s.Cost())
+}
+
+// sessionPath returns the file a session is stored in. IDs come from the
+// command line and /session, so any that could point outside the sessions
+// directory are rejected.
+func sessionPath(projectDir, id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return "", fmt.Errorf("invalid session id %q", id)
+	}
+	return filepath.Join(projectDir, sessionsDir, id+".json"), nil
+}
+
+// saveSession writes a session to disk, replacing any earlier version.
+func saveSession(projectDir string, session *Session) error {
+	path, err := sessionPath(projectDir, session.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a half written session
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadSession reads a session from disk.
+func loadSession(projectDir, id string) (*Session, error) {
+	path, err := sessionPath(projectDir, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, fmt.Errorf("reading session %s: %w", id, err)
+	}
+	return session, nil
+}
+
+// listSessions returns all saved sessions, most recently updated first.
+func listSessions(projectDir string) ([]*Session, error) {
+	entries, err := os.ReadDir(filepath.Join(projectDir, sessionsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		session, err := loadSession(projectDir, strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue // Skip sessions we can't read rather than hiding all of them
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+	return sessions, nil
+}
+
+// deleteSession removes a saved session.
+func deleteSession(projectDir, id string) error {
+	path, err := sessionPath(projectDir, id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionPathRejectsEscapes(t *testing.T) {
+	for _, id := range []string{"", "../x", "..", "a/b", `a\b`, "x/../../y"} {
+		if _, err := sessionPath("project", id); err == nil {
+			t.Errorf("sessionPath accepted %q", id)
+		}
+	}
+	path, err := sessionPath("project", "20260101-120000-abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("project", sessionsDir, "20260101-120000-abcdef.json"); path != want {
+		t.Errorf("got %s, want %s", path, want)
+	}
+}
+
+func TestDeleteSessionStaysInSessionsDir(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(dir, ".pixelheat", "x.json")
+	if err := os.MkdirAll(filepath.Dir(outside), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outside, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteSession(dir, "../x"); err == nil {
+		t.Error("deleted a session outside the sessions directory")
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the sessions directory is gone: %v", err)
+	}
+}
+
+func TestNewSessionIDsAreUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id := newSession().ID
+		if seen[id] {
+			t.Fatalf("session id %s was given out twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestSaveAndLoadSession(t *testing.T) {
+	dir := t.TempDir()
+	session := newSession()
+	session.Messages = []Message{{ID: "1", Role: "user", Content: "hello"}}
+	session.Head = "1"
+	if err := saveSession(dir, session); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadSession(dir, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != session.Name || loaded.Head != "1" || len(loaded.Messages) != 1 {
+		t.Errorf("loaded %+v, want %+v", loaded, session)
+	}
+
+	if err := deleteSession(dir, session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSession(dir, session.ID); err == nil {
+		t.Error("session still loads after deleting it")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Prefix of the branches created for tasks
+const taskBranchPrefix = "pixelheat/"
+
+// Task is an agent session whose accepted edits are committed to their own branch.
+type Task struct {
+	Name       string                 // Name of the task, derived from the session
+	Branch     plumbing.ReferenceName // Branch the edits are committed to
+	BaseBranch plumbing.ReferenceName // Branch the task was started from
+	CheckedOut bool                   // Whether the task branch is the current branch
+	Commits    int                    // Number of commits made on the task branch
+}
+
+var nonBranchChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// taskBranchName turns a session name into a valid branch name.
+func taskBranchName(name string) plumbing.ReferenceName {
+	slug := strings.Trim(nonBranchChars.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+	if slug == "" {
+		slug = "task"
+	}
+	return plumbing.NewBranchReferenceName(taskBranchPrefix + slug)
+}
+
+// startTask creates a task branch from the current branch and checks it out,
+// keeping any local changes.
+func startTask(dir, name string) (*Task, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	if !head.Name().IsBranch() {
+		return nil, fmt.Errorf("HEAD is detached, check out a branch first")
+	}
+
+	task := &Task{Name: name, Branch: taskBranchName(name), BaseBranch: head.Name()}
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	err = w.Checkout(&git.CheckoutOptions{Branch: task.Branch, Create: true, Keep: true})
+	if err != nil {
+		return nil, err
+	}
+
+	task.CheckedOut = true
+	return task, nil
+}
+
+// checkoutBranch switches the working tree to branch. It refuses while tracked
+// files have uncommitted changes, as go-git moves HEAD before updating the
+// working tree and would leave a half-switched checkout behind.
+func checkoutBranch(dir string, branch plumbing.ReferenceName) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := requireCleanWorktree(w); err != nil {
+		return err
+	}
+	return w.Checkout(&git.CheckoutOptions{Branch: branch})
+}
+
+// checkStagedEdits returns an error if changes to files other than the
+// edited ones are staged in the repository in dir, since committing the
+// edits would sweep them into the task commit.
+func checkStagedEdits(dir string, edits []FileEdit) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	return requireOnlyEditsStaged(w, edits)
+}
+
+// requireOnlyEditsStaged is checkStagedEdits for an open worktree.
+func requireOnlyEditsStaged(w *git.Worktree, edits []FileEdit) error {
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+	paths := editPaths(edits)
+	for _, path := range sortedStatusPaths(status) {
+		staging := status[path].Staging
+		if staging != git.Unmodified && staging != git.Untracked && !contains(paths, path) {
+			return fmt.Errorf("%s is staged, commit or unstage it before applying edits to the task", path)
+		}
+	}
+	return nil
+}
+
+// requireCleanWorktree returns an error if a tracked file has staged or
+// unstaged changes. Untracked files are left alone by checkouts.
+func requireCleanWorktree(w *git.Worktree) error {
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+	for _, path := range sortedStatusPaths(status) {
+		fs := status[path]
+		if fs.Worktree == git.Untracked {
+			continue
+		}
+		if fs.Staging != git.Unmodified || fs.Worktree != git.Unmodified {
+			return fmt.Errorf("%s has uncommitted changes, commit or discard them first", path)
+		}
+	}
+	return nil
+}
+
+// headBranch returns the branch HEAD points to.
+func headBranch(dir string) (plumbing.ReferenceName, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	head, err := r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return "", err
+	}
+	return head.Target(), nil
+}
+
+// commitTaskEdits stages the edited paths and commits them on the task branch,
+// recording the originating prompt in the commit body.
+func commitTaskEdits(dir string, task *Task, edits []FileEdit, prompt string) (plumbing.Hash, error) {
+	if !task.CheckedOut {
+		return plumbing.ZeroHash, fmt.Errorf("task branch %s is not checked out", task.Branch.Short())
+	}
+
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := requireOnlyEditsStaged(w, edits); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	for _, edit := range edits {
+		if _, err := w.Add(edit.Path); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+	author, err := gitAuthor(r)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	summary := strings.SplitN(strings.TrimSpace(prompt), "\n", 2)[0]
+	if len(summary) > 60 {
+		summary = summary[:57] + "..."
+	}
+	message := fmt.Sprintf("%s: %s\n\nEdited: %s\n\nPrompt:\n%s\n", task.Name, summary, strings.Join(editPaths(edits), ", "), strings.TrimSpace(prompt))
+
+	hash, err := w.Commit(message, &git.CommitOptions{Author: author})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	task.Commits++
+	return hash, nil
+}
+
+// mergeTask fast-forwards the base branch to the task branch, checks it out
+// and deletes the task branch.
+func mergeTask(dir string, task *Task) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	baseRef, err := r.Reference(task.BaseBranch, true)
+	if err != nil {
+		return err
+	}
+	taskRef, err := r.Reference(task.Branch, true)
+	if err != nil {
+		return err
+	}
+	baseCommit, err := r.CommitObject(baseRef.Hash())
+	if err != nil {
+		return err
+	}
+	taskCommit, err := r.CommitObject(taskRef.Hash())
+	if err != nil {
+		return err
+	}
+
+	ancestor, err := baseCommit.IsAncestor(taskCommit)
+	if err != nil {
+		return err
+	}
+	if !ancestor {
+		return fmt.Errorf("%s has moved on since the task started, only fast-forward merges are supported", task.BaseBranch.Short())
+	}
+
+	// Check out the merged commit first, so the base branch only moves once
+	// the working tree is there
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := requireCleanWorktree(w); err != nil {
+		return err
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Hash: taskCommit.Hash}); err != nil {
+		return err
+	}
+	if err := r.Storer.SetReference(plumbing.NewHashReference(task.BaseBranch, taskCommit.Hash)); err != nil {
+		return err
+	}
+	if err := r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, task.BaseBranch)); err != nil {
+		return err
+	}
+	task.CheckedOut = false
+	return r.Storer.RemoveReference(task.Branch)
+}
+
+// discardTask checks out the base branch and deletes the task branch with its commits.
+func discardTask(dir string, task *Task) error {
+	if err := checkoutBranch(dir, task.BaseBranch); err != nil {
+		return err
+	}
+	task.CheckedOut = false
+
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	return r.Storer.RemoveReference(task.Branch)
+}
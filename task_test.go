@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestTaskBranchName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Fix login bug", "pixelheat/fix-login-bug"},
+		{"  Résumé: v2.1!  ", "pixelheat/r-sum-v2.1"},
+		{"???", "pixelheat/task"},
+	}
+	for _, tt := range tests {
+		if got := taskBranchName(tt.name).Short(); got != tt.want {
+			t.Errorf("taskBranchName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// commitFile writes path and commits it to the repository in dir.
+func commitFile(t *testing.T, dir, path, content string) plumbing.Hash {
+	t.Helper()
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(path); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := w.Commit("edit "+path, &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestTaskCheckoutRefusesLocalChanges(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := git.PlainInit(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "a.txt", "base\n")
+	task, err := startTask(dir, "change a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskHash := commitFile(t, dir, "a.txt", "task\n")
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkoutBranch(dir, task.BaseBranch); err == nil {
+		t.Error("checkout over local changes succeeded")
+	}
+	if err := mergeTask(dir, task); err == nil {
+		t.Error("merge over local changes succeeded")
+	}
+	if head, _ := headBranch(dir); head != task.Branch {
+		t.Errorf("HEAD moved to %s", head)
+	}
+	r, _ := git.PlainOpen(dir)
+	if base, _ := r.Reference(task.BaseBranch, true); base.Hash() == taskHash {
+		t.Error("base branch moved although the merge failed")
+	}
+
+	// Once the change is gone the merge goes through
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("task\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mergeTask(dir, task); err != nil {
+		t.Fatal(err)
+	}
+	if head, _ := headBranch(dir); head != task.BaseBranch {
+		t.Errorf("HEAD is %s, want %s", head, task.BaseBranch)
+	}
+	if base, _ := r.Reference(task.BaseBranch, true); base.Hash() != taskHash {
+		t.Error("base branch was not fast-forwarded")
+	}
+}
+
+func TestApplyEditsCommitsToATask(t *testing.T) {
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.User.Name, cfg.User.Email = "test", "test@example.com"
+	if err := r.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, dir, "a.txt", "base\n")
+	core := &Core{projectDir: dir, session: &Session{Name: "session-1"}}
+
+	// Edits start a task instead of going straight into the working tree
+	result, err := core.ApplyEdits([]FileEdit{{Path: "a.txt", Content: "edited\n"}}, "edit a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := core.GetTask()
+	if task == nil || !task.CheckedOut || task.Commits != 1 {
+		t.Fatalf("got task %+v after %q", task, result)
+	}
+	if head, _ := headBranch(dir); head != task.Branch {
+		t.Errorf("HEAD is %s, want %s", head, task.Branch)
+	}
+
+	// Staged changes to other files stay out of the task commit
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("staged\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := r.Worktree()
+	if _, err := w.Add("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.ApplyEdits([]FileEdit{{Path: "a.txt", Content: "again\n"}}, "edit a again"); err == nil {
+		t.Error("edits were committed together with the staged b.txt")
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(content) != "edited\n" {
+		t.Errorf("refused edits were written: %q", content)
+	}
+	if task.Commits != 1 {
+		t.Errorf("got %d task commits, want 1", task.Commits)
+	}
+
+	// Nothing is applied while the base branch is checked out
+	if _, err := w.Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.SwitchTask(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.ApplyEdits([]FileEdit{{Path: "a.txt", Content: "again\n"}}, "edit a again"); err == nil {
+		t.Error("edits were applied to the base branch")
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Title of the input field, and its title while an earlier message is edited
+const (
+	inputTitle        = " Human Input (Shift-F2 to send) "
+	inputEditingTitle = " Editing earlier message (Shift-F2 to resend as a new branch, Esc to cancel) "
+	chatTrackingTitle = " Chat Tracking (Up/Down select, Enter expand, y copy, e edit, r regenerate, [ ] branches) "
+)
+
+// Messages longer than longMessageLines are collapsed to their first collapsedLines
+const (
+	longMessageLines = 40
+	collapsedLines   = 10
+)
+
+// chatNote is a message from PixelHeat itself, shown after the message that
+// ended the conversation when it was added
+type chatNote struct {
+	After string
+	Text  string
+}
+
+// SetupChatKeybinds adds message selection, editing and branch navigation to Chat Tracking
+func (ui *UI) SetupChatKeybinds(core *Core) {
+	ui.ChatTracking.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyUp || (event.Key() == tcell.KeyRune && event.Rune() == 'k'):
+			ui.moveMessageSelection(core, -1)
+		case event.Key() == tcell.KeyDown || (event.Key() == tcell.KeyRune && event.Rune() == 'j'):
+			ui.moveMessageSelection(core, 1)
+		case event.Key() == tcell.KeyEnter || (event.Key() == tcell.KeyRune && event.Rune() == ' '):
+			ui.toggleSelectedMessage(core)
+		case event.Key() == tcell.KeyRune && event.Rune() == 'y':
+			ui.copySelectedMessage(core)
+		case event.Key() == tcell.KeyRune && event.Rune() == 'e':
+			ui.EditSelectedMessage(core)
+		case event.Key() == tcell.KeyRune && event.Rune() == 'r':
+			ui.ShowRegenerate(core)
+		case event.Key() == tcell.KeyRune && event.Rune() == '+':
+			ui.rateSelectedMessage(core, "good")
+		case event.Key() == tcell.KeyRune && event.Rune() == '-':
+			ui.rateSelectedMessage(core, "bad")
+		case event.Key() == tcell.KeyRune && event.Rune() == '[':
+			ui.switchSelectedBranch(core, -1)
+		case event.Key() == tcell.KeyRune && event.Rune() == ']':
+			ui.switchSelectedBranch(core, 1)
+		default:
+			return event
+		}
+		return nil
+	})
+
+	ui.InputField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape && ui.editingMessage != "" {
+			ui.CancelEdit()
+			return nil
+		}
+		return event
+	})
+}
+
+// moveMessageSelection selects the previous or next message in Chat Tracking
+func (ui *UI) moveMessageSelection(core *Core, delta int) {
+	messages := core.GetStack().getAllMessages()
+	if len(messages) == 0 {
+		return
+	}
+
+	// Start from the newest message when nothing is selected yet
+	index := len(messages)
+	for i, msg := range messages {
+		if msg.ID == ui.selectedMessage {
+			index = i
+			break
+		}
+	}
+	index += delta
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(messages) {
+		index = len(messages) - 1
+	}
+	ui.SelectMessage(messages[index].ID)
+}
+
+// RenderConversation redraws chatTracking from the message stack
+func (ui *UI) RenderConversation(core *Core) {
+	ui.chatWidth = ui.chatTrackingWidth()
+	ui.ChatTracking.SetText(ui.renderChat(core.GetStack(), ui.chatWidth))
+	ui.ChatTracking.ScrollToEnd()
+}
+
+// UpdateChatTracking rewraps the conversation when the pane was resized
+func (ui *UI) UpdateChatTracking(core *Core) {
+	if ui.chatWidth > 0 && ui.chatWidth != ui.chatTrackingWidth() {
+		row, column := ui.ChatTracking.GetScrollOffset()
+		ui.RenderConversation(core)
+		ui.ChatTracking.ScrollTo(row, column)
+	}
+}
+
+// chatTrackingWidth returns the number of columns messages are wrapped to,
+// leaving one for the scroll position
+func (ui *UI) chatTrackingWidth() int {
+	_, _, width, _ := ui.ChatTracking.GetInnerRect()
+	return width - 1
+}
+
+// AppendNote shows a message from PixelHeat itself in chatTracking
+func (ui *UI) AppendNote(note string) {
+	ui.notes = append(ui.notes, chatNote{After: ui.core.GetStack().getHead(), Text: note})
+	ui.RenderConversation(ui.core)
+}
+
+// ResetChat forgets the notes and expanded messages of the previous conversation
+func (ui *UI) ResetChat() {
+	ui.notes = nil
+	ui.toggled = make(map[string]bool)
+	ui.selectedMessage = ""
+}
+
+// renderChat formats the current branch with notes after the messages they
+// followed and the message waiting for an answer at the end
+func (ui *UI) renderChat(stack *MessageStack, width int) string {
+	var sb strings.Builder
+	writeNotes := func(after string) {
+		for _, note := range ui.notes {
+			if note.After == after {
+				sb.WriteString("[::b]PixelHeat::[-] " + tview.Escape(note.Text) + "\n\n")
+			}
+		}
+	}
+
+	writeNotes("")
+	messages, labels := stack.getBranchLabels()
+	for _, msg := range messages {
+		sb.WriteString(ui.formatChatMessage(msg, labels[msg.ID], width) + "\n")
+		writeNotes(msg.ID)
+	}
+	if ui.pendingMessage != "" {
+		sb.WriteString("[::b]User::[-] [gray](waiting for an answer)[-]\n" + renderMarkdown(ui.pendingMessage, width) + "\n")
+	}
+	return sb.String()
+}
+
+// isExpanded reports whether a message is shown in full. Directives, files
+// and long messages start collapsed until the user expands them.
+func (ui *UI) isExpanded(msg Message, lines int) bool {
+	expanded := msg.Role != "system" && lines <= longMessageLines
+	if ui.toggled[msg.ID] {
+		return !expanded
+	}
+	return expanded
+}
+
+// formatChatMessage formats one message inside a region named after its ID,
+// with the label of the branch it is on
+func (ui *UI) formatChatMessage(msg Message, label string, width int) string {
+	body := renderMarkdown(msg.Content, width)
+	lines := strings.Split(body, "\n")
+	expanded := ui.isExpanded(msg, len(lines))
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[\"%s\"]", msg.ID))
+	if msg.Role == "system" {
+		// Summarise by the first line, like "File: main.go"
+		marker := "▸"
+		if expanded {
+			marker = "▾"
+		}
+		summary := strings.SplitN(msg.Content, "\n", 2)[0]
+		if width > 20 && len(summary) > width-20 {
+			summary = summary[:width-20] + "..."
+		}
+		sb.WriteString(fmt.Sprintf("[gray]%s System: %s (%d lines)[-]\n", marker, tview.Escape(summary), strings.Count(msg.Content, "\n")+1))
+		if expanded {
+			sb.WriteString(body + "\n")
+		}
+	} else {
+		role := "User"
+		if msg.Role == "assistant" {
+			role = "Assistant"
+		}
+		step := ""
+		if msg.Step != "" {
+			step = fmt.Sprintf(" [gray]%s, %s[-]", tview.Escape(msg.Step), tview.Escape(msg.Agent))
+		}
+		sb.WriteString(fmt.Sprintf("[::b]%s%s::[-]%s%s\n", role, label, step, ratingLabel(msg.Rating)))
+		switch {
+		case expanded:
+			sb.WriteString(body + "\n")
+		case len(lines) > longMessageLines:
+			sb.WriteString(strings.Join(lines[:collapsedLines], "\n") + "[-:-:-]\n")
+			sb.WriteString(fmt.Sprintf("[gray]... %d more lines, Enter to expand[-]\n", len(lines)-collapsedLines))
+		default:
+			sb.WriteString(fmt.Sprintf("[gray]... %d lines, Enter to expand[-]\n", len(lines)))
+		}
+	}
+	if ui.ShowMetadata {
+		sb.WriteString("[gray]  " + tview.Escape(msg.metadata()) + "[-]\n")
+	}
+	sb.WriteString("[\"\"]")
+	return sb.String()
+}
+
+// toggleSelectedMessage expands or collapses the selected message
+func (ui *UI) toggleSelectedMessage(core *Core) {
+	if ui.selectedMessage == "" {
+		return
+	}
+	ui.toggled[ui.selectedMessage] = !ui.toggled[ui.selectedMessage]
+	row, column := ui.ChatTracking.GetScrollOffset()
+	ui.RenderConversation(core)
+	ui.ChatTracking.ScrollTo(row, column)
+}
+
+// copySelectedMessage copies the selected message's text to the clipboard
+func (ui *UI) copySelectedMessage(core *Core) {
+	msg, ok := core.GetStack().getMessage(ui.selectedMessage)
+	if !ok {
+		ui.AppendNote("Select a message to copy it")
+		return
+	}
+	if err := copyToClipboard(msg.Content); err != nil {
+		ui.AppendNote(fmt.Sprintf("Could not copy message: %v", err))
+		return
+	}
+	ui.AppendNote("Copied message to the clipboard")
+}
+
+// SelectMessage highlights a message in Chat Tracking and scrolls to it
+func (ui *UI) SelectMessage(id string) {
+	ui.selectedMessage = id
+	ui.ChatTracking.Highlight(id).ScrollToHighlight()
+}
+
+// EditSelectedMessage copies the selected user message into the input field
+// so it can be changed and resent as a new branch
+func (ui *UI) EditSelectedMessage(core *Core) {
+	msg, ok := core.GetStack().getMessage(ui.selectedMessage)
+	if !ok || msg.Role != "user" {
+		ui.AppendNote("Select one of your messages to edit it")
+		return
+	}
+
+	ui.editingMessage = msg.ID
+	ui.InputField.SetText(msg.Content, true)
+	ui.InputField.SetTitle(inputEditingTitle)
+	ui.focusPrimitive(ui.InputField)
+}
+
+// CancelEdit leaves editing mode without sending anything
+func (ui *UI) CancelEdit() {
+	ui.editingMessage = ""
+	ui.InputField.SetText("", false)
+	ui.InputField.SetTitle(inputTitle)
+}
+
+// switchSelectedBranch shows the previous or next alternative of the selected message
+func (ui *UI) switchSelectedBranch(core *Core, delta int) {
+	if ui.selectedMessage == "" {
+		return
+	}
+	sibling, err := core.SwitchBranch(ui.selectedMessage, delta)
+	if err != nil {
+		ui.AppendNote(fmt.Sprintf("%v", err))
+		return
+	}
+	ui.RenderConversation(core)
+	ui.SelectMessage(sibling)
+}
+
+// rateSelectedMessage marks the selected answer good or bad, or clears a rating given again
+func (ui *UI) rateSelectedMessage(core *Core, rating string) {
+	msg, ok := core.GetStack().getMessage(ui.selectedMessage)
+	if !ok {
+		return
+	}
+	if msg.Rating == rating {
+		rating = ""
+	}
+	if err := core.RateMessage(msg.ID, rating); err != nil {
+		ui.AppendNote(fmt.Sprintf("%v", err))
+		return
+	}
+	ui.RenderConversation(core)
+	ui.SelectMessage(msg.ID)
+}
+
+// ShowRegenerate lets the user pick another agent or model to answer the last prompt again
+func (ui *UI) ShowRegenerate(core *Core) {
+	reply, ok := core.GetStack().lastReply()
+	if !ok {
+		ui.AppendNote("There is no reply to regenerate")
+		return
+	}
+
+	list := tview.NewList()
+	closePicker := func() {
+		ui.Pages.RemovePage("regenerate")
+		ui.RestoreFocus()
+	}
+
+	for _, agent := range getAIAgents() {
+		agent := agent
+		list.AddItem(tview.Escape(agent.Name), "agent, "+agent.Service().ModelName, 0, func() {
+			closePicker()
+			ui.Regenerate(core, agent.Name, "")
+		})
+	}
+	for _, service := range chatServices() {
+		service := service
+		list.AddItem(tview.Escape(service.ModelName), "model, answered as "+tview.Escape(reply.Agent), 0, func() {
+			closePicker()
+			ui.Regenerate(core, "", service.ModelName)
+		})
+	}
+	list.SetDoneFunc(closePicker)
+	list.SetBorder(true).SetTitle(" Regenerate with (Enter to send, Esc to cancel) ")
+
+	ui.Pages.AddPage("regenerate", centered(list, 70, 24), true, true)
+	ui.App.SetFocus(list)
+}
+
+// Regenerate answers the last prompt again and shows the new answer
+func (ui *UI) Regenerate(core *Core, agent, model string) {
+	ui.InputField.SetText("<regenerating...>", false)
+	ui.InputField.SetDisabled(true)
+
+	go func() {
+		_, err := core.Regenerate(agent, model)
+
+		ui.App.QueueUpdateDraw(func() {
+			ui.InputField.SetText("", false)
+			ui.InputField.SetDisabled(false)
+
+			if err != nil {
+				ui.AppendNote(fmt.Sprintf("Regenerate failed: %v", err))
+				return
+			}
+			ui.RenderConversation(core)
+			ui.SelectMessage(core.GetStack().getHead())
+			ui.UpdateBackendServices()
+		})
+	}()
+}
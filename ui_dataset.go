@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rivo/tview"
+)
+
+// checkbox returns the marker shown in front of a toggled list item
+func checkbox(checked bool) string {
+	if checked {
+		return tview.Escape("[x] ")
+	}
+	return tview.Escape("[ ] ")
+}
+
+// ShowDatasetBuilder lets the user pick sessions and options, then writes a fine-tuning dataset
+func (ui *UI) ShowDatasetBuilder(core *Core) {
+	if err := core.SaveSession(); err != nil {
+		ui.ShowMessage(fmt.Sprintf("Could not save the current session: %v", err))
+		return
+	}
+	sessions, err := listSessions(core.projectDir)
+	if err != nil {
+		ui.ShowMessage(fmt.Sprintf("Could not list sessions: %v", err))
+		return
+	}
+
+	options := DatasetOptions{Epochs: defaultTrainingEpochs}
+	selected := make([]bool, len(sessions))
+
+	list := tview.NewList().ShowSecondaryText(false)
+	closeBuilder := func() {
+		ui.Pages.RemovePage("dataset")
+		ui.RestoreFocus()
+	}
+
+	// Toggles redraw their own item so the list keeps its position
+	toggle := func(label string, value *bool) func() {
+		return func() {
+			*value = !*value
+			list.SetItemText(list.GetCurrentItem(), checkbox(*value)+label, "")
+		}
+	}
+	list.AddItem(checkbox(options.PerTurn)+"One example per answer", "", 0, toggle("One example per answer", &options.PerTurn))
+	list.AddItem(checkbox(options.GoodOnly)+"Only answers rated good", "", 0, toggle("Only answers rated good", &options.GoodOnly))
+	for i, session := range sessions {
+		list.AddItem(checkbox(false)+tview.Escape(session.Summary()), "", 0, toggle(tview.Escape(session.Summary()), &selected[i]))
+	}
+	list.AddItem("Write dataset", "", 'w', func() {
+		var ids []string
+		for i, session := range sessions {
+			if selected[i] {
+				ids = append(ids, session.ID)
+			}
+		}
+		if len(ids) == 0 {
+			ui.ShowMessage("Select at least one session")
+			return
+		}
+		closeBuilder()
+
+		report, err := core.BuildDataset(ids, options)
+		if err != nil {
+			ui.ShowMessage(fmt.Sprintf("Could not build dataset: %v", err))
+			return
+		}
+		ui.AppendNote(report.String())
+	})
+	list.SetDoneFunc(closeBuilder)
+	list.SetBorder(true).SetTitle(" Fine-tuning dataset (Enter to toggle, Esc to close) ")
+
+	ui.Pages.AddPage("dataset", centered(list, 90, 20), true, true)
+	ui.App.SetFocus(list)
+}
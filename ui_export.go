@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rivo/tview"
+)
+
+// ShowExport lets the user pick a format and writes the current session to the exports directory
+func (ui *UI) ShowExport(core *Core) {
+	list := tview.NewList().ShowSecondaryText(false)
+	closePicker := func() {
+		ui.Pages.RemovePage("export")
+		ui.RestoreFocus()
+	}
+
+	export := func(format string) func() {
+		return func() {
+			closePicker()
+			path, err := core.ExportSession(format, "")
+			if err != nil {
+				ui.ShowMessage(fmt.Sprintf("Could not export session: %v", err))
+				return
+			}
+			ui.AppendNote("Exported session to " + path)
+		}
+	}
+	list.AddItem("Markdown", "", 'm', export("markdown"))
+	list.AddItem("HTML", "", 'h', export("html"))
+	list.AddItem("JSONL (for import)", "", 'j', export("jsonl"))
+	list.SetDoneFunc(closePicker)
+	list.SetBorder(true).SetTitle(" Export session ")
+
+	ui.Pages.AddPage("export", centered(list, 40, 7), true, true)
+	ui.App.SetFocus(list)
+}
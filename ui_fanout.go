@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ShowFanOut lays the answers of a fan-out side by side so one can be picked
+// to continue the conversation. The others stay as branches of the reply.
+func (ui *UI) ShowFanOut(core *Core, answers []FanOutAnswer, prompt string) {
+	if len(answers) == 0 {
+		return
+	}
+
+	_, _, width, _ := ui.Pages.GetRect()
+	columnWidth := width/len(answers) - 2 // Room inside the border
+
+	columns := tview.NewFlex()
+	views := make([]*tview.TextView, len(answers))
+	focused := 0
+
+	closeFanOut := func() {
+		ui.Pages.RemovePage("fanout")
+		ui.RestoreFocus()
+	}
+	pick := func(i int) {
+		if answers[i].Err != nil {
+			return // Nothing to continue with
+		}
+		closeFanOut()
+		if err := core.PickAnswer(answers[i].MessageID); err != nil {
+			ui.AppendNote(fmt.Sprintf("Could not pick answer: %v", err))
+			return
+		}
+		ui.RenderConversation(core)
+		ui.AppendNote(fmt.Sprintf("Continuing with %s, the other answers are branches of the reply", answers[i].Agent))
+		ui.OfferEdits(core, answers[i].Content, prompt)
+	}
+	focus := func(i int) {
+		views[focused].SetBorderColor(tcell.ColorWhite)
+		focused = (i + len(views)) % len(views)
+		views[focused].SetBorderColor(tcell.ColorYellow)
+		ui.App.SetFocus(views[focused])
+	}
+
+	for i, answer := range answers {
+		view := tview.NewTextView().SetDynamicColors(true).SetWordWrap(true)
+		if answer.Err != nil {
+			view.SetText("[red]Could not answer:[-] " + tview.Escape(answer.Err.Error()))
+		} else {
+			view.SetText(renderMarkdown(answer.Content, columnWidth))
+		}
+		view.SetBorder(true).SetTitle(fmt.Sprintf(" %d. %s · %s · %.1fs · $%.4f ",
+			i+1, tview.Escape(answer.Agent), answer.Service, answer.Latency.Seconds(), answer.Cost))
+		view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			switch event.Key() {
+			case tcell.KeyEscape:
+				// Keep the current answer, the first one that came back
+				closeFanOut()
+				if err := core.PickAnswer(core.GetStack().getHead()); err != nil {
+					ui.AppendNote(fmt.Sprintf("Could not keep the answer: %v", err))
+				}
+				ui.RenderConversation(core)
+				return nil
+			case tcell.KeyEnter:
+				pick(focused)
+				return nil
+			case tcell.KeyLeft, tcell.KeyBacktab:
+				focus(focused - 1)
+				return nil
+			case tcell.KeyRight, tcell.KeyTab:
+				focus(focused + 1)
+				return nil
+			case tcell.KeyRune:
+				switch event.Rune() {
+				case 'h':
+					focus(focused - 1)
+					return nil
+				case 'l':
+					focus(focused + 1)
+					return nil
+				}
+				if n, err := strconv.Atoi(string(event.Rune())); err == nil && n >= 1 && n <= len(answers) {
+					pick(n - 1)
+					return nil
+				}
+			}
+			return event
+		})
+		views[i] = view
+		columns.AddItem(view, 0, 1, i == 0)
+	}
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(columns, 0, 1, true).
+		AddItem(tview.NewTextView().SetText(" Left/Right choose, Up/Down scroll, Enter or 1-9 continue with an answer, Esc keeps the first"), 1, 0, false)
+
+	ui.Pages.AddPage("fanout", layout, true, true)
+	focus(0)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// hunkItem is an entry of the hunk dialog
+type hunkItem struct {
+	Staged bool
+	Index  int
+	Hunk   diffHunk
+}
+
+// SetupGitKeybinds adds the git actions to the Tracked Files tree
+func (ui *UI) SetupGitKeybinds(core *Core) {
+	ui.TrackedFiles.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() != tcell.KeyRune {
+			return event
+		}
+
+		// Committing doesn't need a file to be selected
+		if event.Rune() == 'c' {
+			ui.ShowCommitDraft(core.GetCommitMessage())
+			return nil
+		}
+
+		// Detach git context sources
+		if source := ui.selectedContextSource(); source != nil {
+			if event.Rune() == 'x' && !source.Fixed {
+				core.RemoveContextSource(source)
+				ui.UpdateContextSources(core)
+				return nil
+			}
+			return event
+		}
+
+		fileNode := ui.selectedFileNode()
+		if fileNode == nil || fileNode.Directory {
+			return event
+		}
+
+		switch event.Rune() {
+		case 's':
+			ui.runGitAction(core, func() error { return core.StageFile(fileNode.Name) })
+		case 'u':
+			ui.runGitAction(core, func() error { return core.UnstageFile(fileNode.Name) })
+		case 'd':
+			ui.Confirm(fmt.Sprintf("Discard all unstaged changes to %s?\n\nThis cannot be undone.", fileNode.Name), func() {
+				ui.runGitAction(core, func() error { return core.DiscardChanges(fileNode.Name) })
+			})
+		case 'h':
+			ui.ShowHunks(core, fileNode.Name)
+		case 'b':
+			core.AddContextSource(&ContextSource{Kind: contextBlame, Arg: fileNode.Name})
+			ui.UpdateContextSources(core)
+		default:
+			return event
+		}
+		return nil
+	})
+}
+
+// selectedFileNode returns the file under the cursor of the Tracked Files tree
+func (ui *UI) selectedFileNode() *FileNode {
+	node := ui.TrackedFiles.GetCurrentNode()
+	if node == nil {
+		return nil
+	}
+	fileNode, _ := node.GetReference().(*FileNode)
+	return fileNode
+}
+
+// selectedContextSource returns the git context source under the cursor of the Tracked Files tree
+func (ui *UI) selectedContextSource() *ContextSource {
+	node := ui.TrackedFiles.GetCurrentNode()
+	if node == nil {
+		return nil
+	}
+	source, _ := node.GetReference().(*ContextSource)
+	return source
+}
+
+// runGitAction runs a git operation and refreshes the file statuses
+func (ui *UI) runGitAction(core *Core, action func() error) {
+	if err := action(); err != nil {
+		ui.ShowMessage(fmt.Sprintf("Git error: %v", err))
+		return
+	}
+	core.Update()
+	ui.UpdateTrackedFiles(core)
+}
+
+// ShowHunks opens a dialog to stage and unstage individual hunks of a file
+func (ui *UI) ShowHunks(core *Core, path string) {
+	list := tview.NewList().ShowSecondaryText(false)
+	preview := tview.NewTextView().SetDynamicColors(true)
+	preview.SetBorder(true)
+
+	var items []hunkItem
+	refresh := func() {
+		items = nil
+		staged, err := stagedHunks(core.projectDir, path)
+		if err != nil {
+			ui.ShowMessage(fmt.Sprintf("Git error: %v", err))
+		}
+		for i, hunk := range staged {
+			items = append(items, hunkItem{Staged: true, Index: i, Hunk: hunk})
+		}
+		unstaged, err := unstagedHunks(core.projectDir, path)
+		if err != nil {
+			ui.ShowMessage(fmt.Sprintf("Git error: %v", err))
+		}
+		for i, hunk := range unstaged {
+			items = append(items, hunkItem{Staged: false, Index: i, Hunk: hunk})
+		}
+
+		current := list.GetCurrentItem()
+		list.Clear()
+		for _, item := range items {
+			label := "[unstaged]"
+			if item.Staged {
+				label = "[staged]  "
+			}
+			list.AddItem(tview.Escape(label+" "+item.Hunk.Header()), "", 0, nil)
+		}
+		if list.GetItemCount() == 0 {
+			preview.SetText("No changes.")
+			return
+		}
+		if current >= list.GetItemCount() {
+			current = list.GetItemCount() - 1
+		}
+		list.SetCurrentItem(current)
+		preview.SetText(colorizeDiff(items[list.GetCurrentItem()].Hunk.String()))
+	}
+
+	list.SetChangedFunc(func(index int, _ string, _ string, _ rune) {
+		if index < len(items) {
+			preview.SetText(colorizeDiff(items[index].Hunk.String())).ScrollToBeginning()
+		}
+	})
+	list.SetSelectedFunc(func(index int, _ string, _ string, _ rune) {
+		item := items[index]
+		if item.Staged {
+			ui.runGitAction(core, func() error { return core.UnstageHunk(path, item.Index) })
+		} else {
+			ui.runGitAction(core, func() error { return core.StageHunk(path, item.Index) })
+		}
+		refresh()
+	})
+	list.SetDoneFunc(func() {
+		ui.Pages.RemovePage("hunks")
+		ui.RestoreFocus()
+	})
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(list, 0, 1, true).
+		AddItem(preview, 0, 3, false)
+	layout.SetBorder(true).SetTitle(fmt.Sprintf(" Hunks of %s (Enter to stage/unstage, Esc to close) ", path))
+
+	refresh()
+	ui.Pages.AddPage("hunks", centered(layout, 100, 40), true, true)
+	ui.App.SetFocus(list)
+}
+
+// colorizeDiff adds colour tags to unified diff text
+func colorizeDiff(diff string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(diff, "\n") {
+		escaped := tview.Escape(line)
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			sb.WriteString("[aqua]" + escaped + "[-]")
+		case strings.HasPrefix(line, "+"):
+			sb.WriteString("[green]" + escaped + "[-]")
+		case strings.HasPrefix(line, "-"):
+			sb.WriteString("[red]" + escaped + "[-]")
+		default:
+			sb.WriteString(escaped)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
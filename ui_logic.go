@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -13,56 +14,84 @@ type AIAgentNode struct {
 	Active  bool
 }
 
+// Height of the Git Commit row, and its height while a commit draft is edited
+const (
+	gitCommitRows      = 4
+	gitCommitDraftRows = 12
+)
+
 type UI struct {
 	App               *tview.Application
+	Pages             *tview.Pages
 	Grid              *tview.Grid
 	TitleBar          *tview.TextView
+	GitCommitPages    *tview.Pages
 	GitCommit         *tview.TextView
+	CommitDraft       *tview.TextArea
 	TrackedFiles      *tview.TreeView
 	AIView            *tview.TreeView
 	BackendServices   *tview.TextView
 	ChatTracking      *tview.TextView
 	InputField        *tview.TextArea
 	FileRoot          *tview.TreeNode
+	ContextRoot       *tview.TreeNode
 	AIViewRoot        *tview.TreeNode
 	aiAgentNodes      []*AIAgentNode
 	CurrentFocus      int
 	Primitives        []tview.Primitive
 	ShowFormattedText bool
+	ShowMetadata      bool
+	selectedMessage   string // Message highlighted in chatTracking
+	editingMessage    string // User message being edited, resent as a new branch
+	chatWidth         int    // Width chatTracking was last rendered for
+	notes             []chatNote
+	toggled           map[string]bool // Messages expanded or collapsed by the user
+	pendingMessage    string          // Message shown while waiting for the agent
+	core              *Core           // Core chatTracking is rendered from, for notes
 }
 
 // NewUI creates a new UI instance
 func NewUI(core *Core) *UI {
 	ui := &UI{
 		App:               tview.NewApplication(),
+		Pages:             tview.NewPages(),
 		Grid:              tview.NewGrid(),
 		TitleBar:          tview.NewTextView(),
+		GitCommitPages:    tview.NewPages(),
 		GitCommit:         tview.NewTextView(),
+		CommitDraft:       tview.NewTextArea(),
 		TrackedFiles:      tview.NewTreeView(),
 		AIView:            tview.NewTreeView(),
 		BackendServices:   tview.NewTextView(),
 		ChatTracking:      tview.NewTextView(),
 		InputField:        tview.NewTextArea(),
 		FileRoot:          tview.NewTreeNode(core.projectDir),
+		ContextRoot:       tview.NewTreeNode("Git Context"),
 		AIViewRoot:        tview.NewTreeNode("AI Agents"),
 		aiAgentNodes:      []*AIAgentNode{},
 		CurrentFocus:      0,
 		Primitives:        []tview.Primitive{},
 		ShowFormattedText: true,
+		toggled:           make(map[string]bool),
+		core:              core,
 	}
 
-	// Generate a new title using AI
-	title := "Assisted Halucinations"
-
-	ui.TitleBar.SetTextAlign(tview.AlignCenter).SetText("[pixelheat] " + title)
+	ui.TitleBar.SetTextAlign(tview.AlignCenter)
+	ui.UpdateTitle(core)
 	ui.BackendServices.SetDynamicColors(true).SetBorder(true).SetTitle(" Backend Services ")
 	ui.TitleBar.SetBorderPadding(1, 1, 2, 2) // Adjust padding as needed
 
 	// Create panes with borders
 	ui.GitCommit.SetText("...").SetBorder(true).SetTitle(" Git Commit ")
+	ui.CommitDraft.SetBorder(true).SetTitle(" Commit Draft (Shift-F4) ")
+	ui.GitCommitPages.
+		AddPage("latest", ui.GitCommit, true, true).
+		AddPage("draft", ui.CommitDraft, true, false)
 
 	// Create a root node for each of the trees
 	ui.FileRoot.SetColor(tcell.ColorWhite)
+	ui.ContextRoot.SetColor(tcell.ColorWhite)
+	ui.FileRoot.AddChild(ui.ContextRoot)
 	ui.AIViewRoot.SetColor(tcell.ColorWhite)
 	ui.TrackedFiles.SetRoot(ui.FileRoot).
 		SetCurrentNode(ui.FileRoot).
@@ -73,28 +102,31 @@ func NewUI(core *Core) *UI {
 		SetBorder(false)
 
 	// Chat tracking pane
-	ui.ChatTracking.SetDynamicColors(true).SetBorder(true).SetTitle(" Chat Tracking ")
-	ui.ChatTracking.SetScrollable(true)
+	ui.ChatTracking.SetDynamicColors(true).SetBorder(true).SetTitle(chatTrackingTitle)
+	ui.ChatTracking.SetScrollable(true).SetRegions(true)
 
 	// Input field for user input
 	ui.InputField.SetBorder(true)
-	ui.InputField.SetTitle(" Human Input (Shift-F2 to send) ")
+	ui.InputField.SetTitle(inputTitle)
 	ui.InputField.SetPlaceholder("Enter your message here...\nPress Shift-F2 to send.")
 
 	// Create a slice of focusable primitives.
 	ui.AddPrimitive(ui.InputField)
 	ui.AddPrimitive(ui.TrackedFiles)
 	ui.AddPrimitive(ui.AIView)
+	ui.AddPrimitive(ui.ChatTracking)
 	ui.SetupKeybinds(core)
+	ui.SetupGitKeybinds(core)
+	ui.SetupChatKeybinds(core)
 
 	// Layout
 	ui.Grid.
 		//     t git chat ai input
-		SetRows(3, 4, 0, 0, 4). // Rows remain unchanged
-		SetColumns(30, 0, 0).   // Adjusted column widths
+		SetRows(3, gitCommitRows, 0, 0, 4). // Rows remain unchanged
+		SetColumns(30, 0, 0).               // Adjusted column widths
 		//                r  c  rs cs mh mw
 		AddItem(ui.TitleBar, 0, 0, 1, 3, 0, 0, false).
-		AddItem(ui.GitCommit, 1, 0, 1, 1, 0, 0, false).
+		AddItem(ui.GitCommitPages, 1, 0, 1, 1, 0, 0, false).
 		AddItem(ui.BackendServices, 1, 1, 1, 2, 0, 0, false).
 		AddItem(ui.TrackedFiles, 2, 0, 2, 1, 0, 0, false).
 		//                 r  c  rs cs mh mw
@@ -102,7 +134,8 @@ func NewUI(core *Core) *UI {
 		AddItem(ui.ChatTracking, 2, 1, 3, 2, 0, 0, false).
 		AddItem(ui.InputField, 5, 1, 1, 2, 0, 0, true)
 
-	ui.App.SetRoot(ui.Grid, true)
+	ui.Pages.AddPage("main", ui.Grid, true, true)
+	ui.App.SetRoot(ui.Pages, true)
 	return ui
 }
 
@@ -112,7 +145,7 @@ func (ui *UI) SetupKeybinds(core *Core) {
 	// Capture user input to switch focus.
 	ui.App.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		// Capture the Tab key to switch focus.
-		if (event.Key() == tcell.KeyTab) && ui.ShowFormattedText {
+		if (event.Key() == tcell.KeyTab) && ui.ShowFormattedText && ui.mainPageInFront() {
 			// Increment the current focus index, wrapping around if necessary.
 			ui.CurrentFocus = (ui.CurrentFocus + 1) % len(ui.Primitives)
 			// Set the new focus.
@@ -124,7 +157,7 @@ func (ui *UI) SetupKeybinds(core *Core) {
 		if event.Key() == tcell.KeyF1 && event.Modifiers() == tcell.ModShift {
 			ui.ShowFormattedText = !ui.ShowFormattedText
 			if ui.ShowFormattedText {
-				ui.App.SetRoot(ui.Grid, true)
+				ui.App.SetRoot(ui.Pages, true)
 			} else {
 				plainTextView := tview.NewTextView().SetText(stack.getPlainText())
 				ui.App.SetRoot(plainTextView, true)
@@ -137,63 +170,157 @@ func (ui *UI) SetupKeybinds(core *Core) {
 			ui.HandleInput(core)
 		}
 
+		// Capture Shift-F5 to show or hide message metadata
+		if event.Key() == tcell.KeyF5 && event.Modifiers() == tcell.ModShift {
+			ui.ShowMetadata = !ui.ShowMetadata
+			ui.RenderConversation(core)
+			return nil
+		}
+
+		// Capture Shift-F3 to draft a commit message from the staged diff
+		if event.Key() == tcell.KeyF3 && event.Modifiers() == tcell.ModShift {
+			ui.GenerateCommitMessage(core)
+			return nil
+		}
+
+		// Capture Shift-F4 to commit the staged changes with the draft message
+		if event.Key() == tcell.KeyF4 && event.Modifiers() == tcell.ModShift {
+			ui.CommitDraftMessage(core)
+			return nil
+		}
+
+		// Capture Shift-F6 to export the conversation
+		if event.Key() == tcell.KeyF6 && event.Modifiers() == tcell.ModShift {
+			ui.ShowExport(core)
+			return nil
+		}
+
+		// Capture Shift-F7 to search saved sessions
+		if event.Key() == tcell.KeyF7 && event.Modifiers() == tcell.ModShift {
+			ui.ShowSearch(core, "")
+			return nil
+		}
+
+		// Capture Shift-F8 to show the plan
+		if event.Key() == tcell.KeyF8 && event.Modifiers() == tcell.ModShift {
+			ui.ShowPlan(core, 0)
+			return nil
+		}
+
 		// Propagate all other events.
 		return event
 	})
 
+	// Escape discards the commit draft
+	ui.CommitDraft.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			core.SetCommitMessage("")
+			ui.HideCommitDraft()
+			return nil
+		}
+		return event
+	})
+
 	ui.TrackedFiles.SetSelectedFunc(func(node *tview.TreeNode) {
-		ref := node.GetReference()
-		if ref == nil {
-			return
+		switch ref := node.GetReference().(type) {
+		case *FileNode:
+			ui.toggleFileNode(node, ref)
+		case *ContextSource:
+			ui.toggleContextSource(core, node, ref)
 		}
-		fileNode := ref.(*FileNode)
-		fileNode.Active = !fileNode.Active // Toggle the active state
+	})
 
-		// If the fileNode is active, add a child node with "*ACTIVE*"
-		// If the fileNode is not active, remove all child nodes (assuming it only has the "*ACTIVE*" node)
-		if fileNode.Active {
-			// Add "*ACTIVE*" as a child node
-			activeNode := tview.NewTreeNode(fmt.Sprintf("*ACTIVE* (%d)", getTokens(fileNode.Name)))
-			activeNode.SetColor(tcell.ColorBlue)
-			node.AddChild(activeNode)
-		} else {
-			color := DetermineColorBasedOnStatus(fileNode.Status)
-			node.SetColor(color)
-			// Remove all child nodes
-			for _, child := range node.GetChildren() {
-				node.RemoveChild(child)
+	// m shows what the selected agent remembers
+	ui.AIView.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRune && event.Rune() == 'm' {
+			if agentNode, ok := ui.AIView.GetCurrentNode().GetReference().(*AIAgentNode); ok {
+				ui.ShowMemory(core, agentNode.Name)
+				return nil
 			}
 		}
+		return event
 	})
 
 	ui.AIView.SetSelectedFunc(func(node *tview.TreeNode) {
-		ref := node.GetReference()
-		if ref == nil {
-			return
+		switch ref := node.GetReference().(type) {
+		case *AIAgentNode:
+			ui.setAgentActive(core, node, ref, !ref.Active) // Toggle the active state
+		case *agentParamsNode:
+			ui.ShowAgentParams(core, ref.Name)
+		case error:
+			ui.ShowMessage(ref.Error())
 		}
-		agentNode := ref.(*AIAgentNode)
-		agentNode.Active = !agentNode.Active // Toggle the active state
+	})
 
-		// If the agentNode is active, add a child node with "*ACTIVE*"
-		// If the agentNode is not active, remove all child nodes (assuming it only has the "*ACTIVE*" node)
-		if agentNode.Active {
-			// Add "*ACTIVE*" as a child node
-			activeNode := tview.NewTreeNode("*ACTIVE*")
-			activeNode.SetColor(tcell.ColorBlue)
-			node.AddChild(activeNode)
+}
 
-			core.AddActiveAIAgent(agentNode)
-		} else {
-			// Remove all child nodes
-			for _, child := range node.GetChildren() {
-				if child.GetText() == "*ACTIVE*" {
-					node.RemoveChild(child)
-				}
+// toggleFileNode toggles whether a file is attached to requests
+func (ui *UI) toggleFileNode(node *tview.TreeNode, fileNode *FileNode) {
+	ui.setFileActive(node, fileNode, !fileNode.Active) // Toggle the active state
+}
+
+// setFileActive sets whether a file is attached to requests
+func (ui *UI) setFileActive(node *tview.TreeNode, fileNode *FileNode, active bool) {
+	if fileNode.Active == active {
+		return
+	}
+	fileNode.Active = active
+
+	// If the fileNode is active, add a child node with "*ACTIVE*"
+	// If the fileNode is not active, remove all child nodes (assuming it only has the "*ACTIVE*" node)
+	if fileNode.Active {
+		// Add "*ACTIVE*" as a child node
+		activeNode := tview.NewTreeNode(fmt.Sprintf("*ACTIVE* (%d)", getTokens(fileNode.Name)))
+		activeNode.SetColor(tcell.ColorBlue)
+		node.AddChild(activeNode)
+	} else {
+		color := DetermineColorBasedOnStatus(fileNode.Status)
+		node.SetColor(color)
+		// Remove all child nodes
+		for _, child := range node.GetChildren() {
+			node.RemoveChild(child)
+		}
+	}
+}
+
+// setAgentActive sets whether an agent handles requests
+func (ui *UI) setAgentActive(core *Core, node *tview.TreeNode, agentNode *AIAgentNode, active bool) {
+	if agentNode.Active == active {
+		return
+	}
+	agentNode.Active = active
+
+	// If the agentNode is active, add a child node with "*ACTIVE*"
+	// If the agentNode is not active, remove all child nodes (assuming it only has the "*ACTIVE*" node)
+	if agentNode.Active {
+		// Add "*ACTIVE*" as a child node
+		activeNode := tview.NewTreeNode("*ACTIVE*")
+		activeNode.SetColor(tcell.ColorBlue)
+		node.AddChild(activeNode)
+
+		core.AddActiveAIAgent(agentNode)
+	} else {
+		// Remove all child nodes
+		for _, child := range node.GetChildren() {
+			if child.GetText() == "*ACTIVE*" {
+				node.RemoveChild(child)
 			}
-			core.RemoveActiveAIAgent(agentNode)
 		}
-	})
+		core.RemoveActiveAIAgent(agentNode)
+	}
+}
 
+// toggleContextSource toggles whether a git context source is attached to requests
+func (ui *UI) toggleContextSource(core *Core, node *tview.TreeNode, source *ContextSource) {
+	source.Active = !source.Active
+
+	if source.Active {
+		activeNode := tview.NewTreeNode(fmt.Sprintf("*ACTIVE* (%d)", source.Tokens(core.projectDir)))
+		activeNode.SetColor(tcell.ColorBlue)
+		node.AddChild(activeNode)
+	} else {
+		node.ClearChildren()
+	}
 }
 
 // AddPrimitive adds a primitive to the UI
@@ -202,6 +329,82 @@ func (ui *UI) AddPrimitive(p tview.Primitive) {
 	ui.App.SetFocus(ui.Primitives[ui.CurrentFocus])
 }
 
+// RemovePrimitive removes a primitive from the focus cycle
+func (ui *UI) RemovePrimitive(p tview.Primitive) {
+	for i, existing := range ui.Primitives {
+		if existing == p {
+			ui.Primitives = append(ui.Primitives[:i], ui.Primitives[i+1:]...)
+			if ui.CurrentFocus >= len(ui.Primitives) {
+				ui.CurrentFocus = 0
+			}
+			break
+		}
+	}
+	ui.RestoreFocus()
+}
+
+// focusPrimitive moves focus to one of the focusable primitives
+func (ui *UI) focusPrimitive(p tview.Primitive) {
+	for i, existing := range ui.Primitives {
+		if existing == p {
+			ui.CurrentFocus = i
+			break
+		}
+	}
+	ui.App.SetFocus(p)
+}
+
+// RestoreFocus focuses the current primitive of the focus cycle
+func (ui *UI) RestoreFocus() {
+	ui.App.SetFocus(ui.Primitives[ui.CurrentFocus])
+}
+
+// mainPageInFront reports whether no dialog is covering the main grid
+func (ui *UI) mainPageInFront() bool {
+	name, _ := ui.Pages.GetFrontPage()
+	return name == "main"
+}
+
+// Confirm shows a yes/no dialog and calls onYes if the user accepts
+func (ui *UI) Confirm(text string, onYes func()) {
+	modal := tview.NewModal().
+		SetText(text).
+		AddButtons([]string{"Yes", "No"}).
+		SetDoneFunc(func(_ int, label string) {
+			ui.Pages.RemovePage("confirm")
+			ui.RestoreFocus()
+			if label == "Yes" {
+				onYes()
+			}
+		})
+	ui.Pages.AddPage("confirm", modal, false, true)
+	ui.App.SetFocus(modal)
+}
+
+// ShowMessage shows an informational dialog
+func (ui *UI) ShowMessage(text string) {
+	modal := tview.NewModal().
+		SetText(text).
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(_ int, _ string) {
+			ui.Pages.RemovePage("message")
+			ui.RestoreFocus()
+		})
+	ui.Pages.AddPage("message", modal, false, true)
+	ui.App.SetFocus(modal)
+}
+
+// centered wraps a primitive so it is shown in the middle of the screen
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}
+
 // SwitchFocus handles focus switching
 func (ui *UI) SwitchFocus() {
 	ui.CurrentFocus = (ui.CurrentFocus + 1) % len(ui.Primitives)
@@ -213,21 +416,87 @@ func (ui *UI) HandleInput(core *Core) {
 
 	userMessage := ui.InputField.GetText()
 
+	// Slash commands are handled by PixelHeat instead of an agent
+	if isCommand(userMessage) {
+		ui.HandleCommand(core, userMessage)
+		return
+	}
+
+	// Resending an edited message starts a new branch next to the original
+	if ui.editingMessage != "" {
+		if err := core.BranchFrom(ui.editingMessage); err != nil {
+			ui.AppendNote(fmt.Sprintf("Could not edit message: %v", err))
+			return
+		}
+		ui.editingMessage = ""
+		ui.InputField.SetTitle(inputTitle)
+		ui.RenderConversation(core)
+	}
+
 	ui.InputField.SetText("<sending to agent...>", false)
 	ui.InputField.SetDisabled(true)
 
-	// Display user's message in chatTracking
-	ui.ChatTracking.SetText(ui.ChatTracking.GetText(true) + "\n[::b]User::[-] " + userMessage)
+	// Display user's message in chatTracking until the agent answers
+	ui.pendingMessage = userMessage
+	ui.RenderConversation(core)
+
+	// Several active agents answer side by side, unless an agent is @mentioned
+	if core.CanFanOut() && !core.ShouldRoute(userMessage) {
+		go func() {
+			answers, err := core.FanOut(userMessage)
+			// Parameters set with /params only apply to this prompt
+			core.SetRequestParams(GenerationParams{})
+
+			ui.App.QueueUpdateDraw(func() {
+				ui.pendingMessage = ""
+				ui.RenderConversation(core)
+				ui.InputField.SetText("", false)
+				ui.InputField.SetDisabled(false)
+				ui.UpdateBackendServices()
+				if err != nil {
+					ui.AppendNote(err.Error())
+					return
+				}
+				ui.ShowFanOut(core, answers, userMessage)
+			})
+		}()
+		return
+	}
 
 	// Use a goroutine to make the API call asynchronously
 	go func() {
 
-		response := core.HandleInput(userMessage)
+		var response string
+		if core.ShouldRoute(userMessage) {
+			decision, err := core.Route(userMessage)
+			ui.App.QueueUpdateDraw(func() {
+				if err != nil {
+					ui.AppendNote(fmt.Sprintf("Could not route the prompt: %v", err))
+					return
+				}
+				ui.AppendNote(decision.String())
+			})
+			if err == nil {
+				response = core.SendTo(decision.Agent, decision.Prompt)
+			}
+		} else {
+			response = core.HandleInput(userMessage, func() {
+				// Show each pipeline step as soon as it answers
+				ui.App.QueueUpdateDraw(func() {
+					ui.pendingMessage = ""
+					ui.RenderConversation(core)
+				})
+			})
+		}
+
+		// Parameters set with /params only apply to this prompt
+		core.SetRequestParams(GenerationParams{})
 
 		// Update the UI in the main goroutine
 		ui.App.QueueUpdateDraw(func() {
 			// Display API's response in chatTracking
-			ui.ChatTracking.SetText(ui.ChatTracking.GetText(true) + "\n[::b]Assistant::[-] " + response)
+			ui.pendingMessage = ""
+			ui.RenderConversation(core)
 
 			// Clear the inputField and enable it
 			ui.InputField.SetText("", false)
@@ -241,23 +510,154 @@ func (ui *UI) HandleInput(core *Core) {
 
 			// Set the latest git commit message
 			ui.GitCommit.SetText(getLatestGitCommit())
+
+			// Offer to apply any file edits in the response
+			ui.OfferEdits(core, response, userMessage)
 		})
 	}()
 
 }
 
+// HandleCommand runs a slash command and shows its output in chatTracking
+func (ui *UI) HandleCommand(core *Core, input string) {
+	ui.InputField.SetText("<running command...>", false)
+	ui.InputField.SetDisabled(true)
+
+	go func() {
+		output, err := runCommand(ui, core, input)
+
+		ui.App.QueueUpdateDraw(func() {
+			ui.InputField.SetText("", false)
+			ui.InputField.SetDisabled(false)
+
+			if err != nil {
+				ui.AppendNote(fmt.Sprintf("%s failed: %v", strings.Fields(input)[0], err))
+				return
+			}
+			if output != "" {
+				ui.AppendNote(output)
+			}
+		})
+	}()
+}
+
+// OfferEdits asks the user whether to apply the file edits found in a response
+func (ui *UI) OfferEdits(core *Core, response, prompt string) {
+	edits := parseFileEdits(response)
+	if len(edits) == 0 {
+		return
+	}
+
+	ui.Confirm(fmt.Sprintf("Apply edits to %s?", strings.Join(editPaths(edits), ", ")), func() {
+		result, err := core.ApplyEdits(edits, prompt)
+		if err != nil {
+			ui.ShowMessage(fmt.Sprintf("Could not apply edits: %v", err))
+			return
+		}
+		ui.AppendNote(result)
+		ui.UpdateGitCommit()
+	})
+}
+
+// GenerateCommitMessage drafts a commit message for the staged changes
+func (ui *UI) GenerateCommitMessage(core *Core) {
+	ui.ShowCommitDraft("<generating commit message...>")
+	ui.CommitDraft.SetDisabled(true)
+
+	go func() {
+		message, err := core.GenerateCommitMessage()
+
+		ui.App.QueueUpdateDraw(func() {
+			ui.CommitDraft.SetDisabled(false)
+			if err != nil {
+				ui.HideCommitDraft()
+				ui.ShowMessage(fmt.Sprintf("Could not generate commit message: %v", err))
+				return
+			}
+			ui.ShowCommitDraft(message)
+		})
+	}()
+}
+
+// CommitDraftMessage commits the staged changes with the draft message after confirmation
+func (ui *UI) CommitDraftMessage(core *Core) {
+	name, _ := ui.GitCommitPages.GetFrontPage()
+	if name != "draft" {
+		ui.ShowMessage("No commit draft. Press Shift-F3 to generate one.")
+		return
+	}
+
+	message := ui.CommitDraft.GetText()
+	summary := strings.SplitN(strings.TrimSpace(message), "\n", 2)[0]
+	ui.Confirm(fmt.Sprintf("Commit staged changes?\n\n%s", summary), func() {
+		hash, err := core.CommitStaged(message)
+		if err != nil {
+			ui.ShowMessage(fmt.Sprintf("Commit failed: %v", err))
+			return
+		}
+		ui.HideCommitDraft()
+		ui.UpdateGitCommit()
+		ui.ShowMessage(fmt.Sprintf("Committed %s", hash))
+	})
+}
+
+// ShowCommitDraft shows the editable commit draft in the Git Commit pane
+func (ui *UI) ShowCommitDraft(message string) {
+	ui.CommitDraft.SetText(message, false)
+	ui.GitCommitPages.SwitchToPage("draft")
+	ui.Grid.SetRows(3, gitCommitDraftRows, 0, 0, 4)
+
+	// Make the draft reachable with Tab while it is shown
+	found := false
+	for _, p := range ui.Primitives {
+		if p == ui.CommitDraft {
+			found = true
+		}
+	}
+	if !found {
+		ui.AddPrimitive(ui.CommitDraft)
+	}
+	ui.CurrentFocus = len(ui.Primitives) - 1
+	ui.RestoreFocus()
+}
+
+// HideCommitDraft returns the Git Commit pane to showing the latest commit
+func (ui *UI) HideCommitDraft() {
+	ui.GitCommitPages.SwitchToPage("latest")
+	ui.Grid.SetRows(3, gitCommitRows, 0, 0, 4)
+	ui.RemovePrimitive(ui.CommitDraft)
+}
+
 // Draw draws the UI to the screen
 func (ui *UI) Draw(core *Core) {
 	go func() {
 		ui.App.QueueUpdateDraw(func() {
-			ui.UpdateAIView()
+			ui.UpdateTitle(core)
+			ui.UpdateAIView(core)
 			ui.UpdateTrackedFiles(core)
+			ui.UpdateContextSources(core)
 			ui.UpdateGitCommit()
 			ui.UpdateBackendServices()
+			ui.UpdateChatTracking(core)
 		})
 	}()
 }
 
+// UpdateTitle updates the title bar, showing the running task if there is one
+func (ui *UI) UpdateTitle(core *Core) {
+	// Generate a new title using AI
+	title := "[pixelheat] Assisted Halucinations"
+
+	if task := core.GetTask(); task != nil {
+		branch := task.BaseBranch.Short()
+		if task.CheckedOut {
+			branch = task.Branch.Short()
+		}
+		title += fmt.Sprintf(" - task %s (on %s)", task.Branch.Short(), branch)
+	}
+	ui.TitleBar.SetText(title)
+}
+
 // UpdateGitCommit updates the git commit text view
 func (ui *UI) UpdateGitCommit() {
 
@@ -270,10 +670,10 @@ func (ui *UI) UpdateBackendServices() {
 	var servicesStr string
 	for _, model := range models {
 		for _, service := range model.Services {
-			count := serviceUsage[service.ModelName]
-			cost := (float64(service.InputTokens)/1000)*(service.InputCost) + (float64(service.OutputTokens)/1000)*(service.OutputCost) // Assuming cost is per 1K tokens
+			count, inputTokens, outputTokens := serviceTotals(service)
+			cost := (float64(inputTokens)/1000)*(service.InputCost) + (float64(outputTokens)/1000)*(service.OutputCost) // Assuming cost is per 1K tokens
 			if cost > 0 || count > 0 {
-				servicesStr += fmt.Sprintf("%s [API Requests: %d, Cost: $%.2f (%d|%d)]   ", service.ModelName, count, cost, service.InputTokens, service.OutputTokens)
+				servicesStr += fmt.Sprintf("%s [API Requests: %d, Cost: $%.2f (%d|%d)]   ", service.ModelName, count, cost, inputTokens, outputTokens)
 			}
 		}
 	}
@@ -281,11 +681,6 @@ func (ui *UI) UpdateBackendServices() {
 	ui.BackendServices.SetText(servicesStr)
 }
 
-// UpdateChatTracking updates the chat tracking text view
-func (ui *UI) UpdateChatTracking() {
-	// ...
-}
-
 // UpdateInputField updates the input field
 func (ui *UI) UpdateInputField() {
 	// ...
@@ -302,8 +697,8 @@ func (ui *UI) UpdateTrackedFiles(core *Core) {
 			if ref == nil {
 				return false
 			}
-			existingFileNode := ref.(*FileNode)
-			return existingFileNode == fileNode
+			existingFileNode, ok := ref.(*FileNode)
+			return ok && existingFileNode == fileNode
 		})
 
 		if existingNode == nil {
@@ -320,19 +715,53 @@ func (ui *UI) UpdateTrackedFiles(core *Core) {
 	}
 }
 
-func (ui *UI) UpdateAIView() {
-	for _, agent := range aiAgents {
-		foundMatch := false
-		matchingAgent := &tview.TreeNode{}
+// UpdateContextSources updates the git context nodes of the tracked files tree view
+func (ui *UI) UpdateContextSources(core *Core) {
+	sources := core.GetContextSources()
+
+	for _, source := range sources {
+		existingNode := findChildNode(ui.ContextRoot, func(node *tview.TreeNode) bool {
+			return node.GetReference() == source
+		})
+		if existingNode == nil {
+			node := tview.NewTreeNode(source.Name())
+			node.SetColor(tcell.ColorMediumPurple)
+			node.SetReference(source)
+			ui.ContextRoot.AddChild(node)
+		}
+	}
+
+	// Remove nodes of sources that were detached
+	for _, node := range ui.ContextRoot.GetChildren() {
+		found := false
+		for _, source := range sources {
+			if node.GetReference() == source {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ui.ContextRoot.RemoveChild(node)
+		}
+	}
+}
+
+// UpdateAIView shows the loaded agents and their services, and the problems
+// found in agent and pipeline definition files as red nodes
+func (ui *UI) UpdateAIView(core *Core) {
+	agents := getAIAgents()
+	for _, agent := range agents {
+		var matchingAgent *tview.TreeNode
 		for _, existingNode := range ui.AIViewRoot.GetChildren() {
-			if existingNode.GetText() == agent.Name {
-				foundMatch = true
+			if agentNode, ok := existingNode.GetReference().(*AIAgentNode); ok && agentNode.Name == agent.Name {
+				// The definition may have been reloaded
+				core.SetNodeAgent(agentNode, agent)
 				matchingAgent = existingNode
 				break
 			}
 		}
 
-		if !foundMatch {
+		if matchingAgent == nil {
 			// We haven't seen this agent yet, make a new node
 			agentNode := &AIAgentNode{Name: agent.Name, Active: false, AIAgent: agent}
 			ui.aiAgentNodes = append(ui.aiAgentNodes, agentNode)
@@ -354,24 +783,68 @@ func (ui *UI) UpdateAIView() {
 			if !foundService {
 				// This service doesn't yet have a node, add it
 				serviceNode := tview.NewTreeNode(service.ModelName).SetColor(tcell.ColorCadetBlue)
+				serviceNode.SetReference(service)
 				matchingAgent.AddChild(serviceNode)
 			}
 		}
+
+		// Show the generation parameters, selecting them opens an editor
+		paramsText := "Parameters: " + agent.Params.String()
+		paramsNode := findChildNode(matchingAgent, func(node *tview.TreeNode) bool {
+			_, ok := node.GetReference().(*agentParamsNode)
+			return ok
+		})
+		if paramsNode == nil {
+			paramsNode = tview.NewTreeNode(paramsText).SetColor(tcell.ColorGray)
+			paramsNode.SetReference(&agentParamsNode{Name: agent.Name})
+			matchingAgent.AddChild(paramsNode)
+		}
+		paramsNode.SetText(paramsText)
+
+		// Remove services the agent no longer uses
+		for _, existingService := range matchingAgent.GetChildren() {
+			service, ok := existingService.GetReference().(*Service)
+			if ok && !contains(serviceNames(agent.Services), service.ModelName) {
+				matchingAgent.RemoveChild(existingService)
+			}
+		}
 	}
 
-	// Now, remove any agent nodes that are no longer in aiAgents
+	// Now, remove any agent nodes that are no longer loaded, and errors that were fixed
+	errs := append(append([]error(nil), getAgentErrors()...), getPipelineErrors()...)
 	for _, existingNode := range ui.AIViewRoot.GetChildren() {
-		foundMatch := false
-		for _, agent := range aiAgents {
-			if existingNode.GetText() == agent.Name {
-				foundMatch = true
-				break
+		switch ref := existingNode.GetReference().(type) {
+		case *AIAgentNode:
+			if findAIAgent(ref.Name) == nil {
+				ui.setAgentActive(core, existingNode, ref, false)
+				ui.AIViewRoot.RemoveChild(existingNode)
+			}
+		case error:
+			found := false
+			for _, err := range errs {
+				if err.Error() == ref.Error() {
+					found = true
+					break
+				}
+			}
+			if !found {
+				ui.AIViewRoot.RemoveChild(existingNode)
 			}
 		}
+	}
 
-		if !foundMatch {
-			// This node doesn't match any agent, remove it
-			ui.AIViewRoot.RemoveChild(existingNode)
+	for _, err := range errs {
+		found := false
+		for _, existingNode := range ui.AIViewRoot.GetChildren() {
+			if ref, ok := existingNode.GetReference().(error); ok && ref.Error() == err.Error() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errorNode := tview.NewTreeNode("! " + err.Error()).SetColor(tcell.ColorRed)
+			errorNode.SetReference(err)
+			ui.AIViewRoot.AddChild(errorNode)
 		}
 	}
 }
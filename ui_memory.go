@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ShowMemory lists what an agent remembers about the project, letting the
+// user add, edit and delete facts.
+func (ui *UI) ShowMemory(core *Core, agent string) {
+	facts, err := core.GetMemory(agent)
+	if err != nil {
+		ui.ShowMessage(fmt.Sprintf("Could not load memory: %v", err))
+		return
+	}
+
+	list := tview.NewList()
+	closeMemory := func() {
+		ui.Pages.RemovePage("memory")
+		ui.RestoreFocus()
+	}
+	reopen := func(err error) {
+		closeMemory()
+		if err != nil {
+			ui.ShowMessage(fmt.Sprintf("Could not change memory: %v", err))
+			return
+		}
+		ui.ShowMemory(core, agent)
+	}
+
+	for _, fact := range facts {
+		fact := fact
+		list.AddItem(tview.Escape(fact.Text), fact.Time.Format("2006-01-02 15:04"), 0, func() {
+			ui.editText("Fact", fact.Text, func(text string) {
+				reopen(core.UpdateFact(agent, fact.ID, text))
+			})
+		})
+	}
+	if len(facts) == 0 {
+		list.AddItem("Nothing remembered yet", "press a to add a fact", 0, nil)
+	}
+
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() != tcell.KeyRune {
+			return event
+		}
+		switch event.Rune() {
+		case 'a':
+			ui.editText("Fact", "", func(text string) {
+				reopen(core.Remember(agent, text))
+			})
+			return nil
+		case 'd':
+			if index := list.GetCurrentItem(); index < len(facts) {
+				fact := facts[index]
+				ui.Confirm(fmt.Sprintf("Forget %q?", fact.Text), func() {
+					reopen(core.ForgetFact(agent, fact.ID))
+				})
+			}
+			return nil
+		}
+		return event
+	})
+	list.SetDoneFunc(closeMemory)
+	list.SetBorder(true).SetTitle(fmt.Sprintf(" Memory of %s (Enter to edit, a to add, d to delete, Esc to close) ", tview.Escape(agent)))
+
+	ui.Pages.AddPage("memory", centered(list, 90, 24), true, true)
+	ui.App.SetFocus(list)
+}
+
+// editText asks for a line of text, like a fact or a plan step, and calls
+// onDone with it, unless cancelled.
+func (ui *UI) editText(title, text string, onDone func(string)) {
+	input := tview.NewInputField().SetText(text)
+	focused := ui.App.GetFocus()
+	input.SetDoneFunc(func(key tcell.Key) {
+		ui.Pages.RemovePage("edit")
+		if key == tcell.KeyEnter {
+			onDone(input.GetText())
+			return
+		}
+		ui.App.SetFocus(focused)
+	})
+	input.SetBorder(true).SetTitle(fmt.Sprintf(" %s (Enter to save, Esc to cancel) ", title))
+
+	ui.Pages.AddPage("edit", centered(input, 90, 3), true, true)
+	ui.App.SetFocus(input)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rivo/tview"
+)
+
+// agentParamsNode is the AI Agents node showing an agent's generation parameters.
+type agentParamsNode struct {
+	Name string
+}
+
+// ShowAgentParams edits an agent's generation parameters. Saved values are
+// kept in the project and used instead of those in the agent's file.
+func (ui *UI) ShowAgentParams(core *Core, name string) {
+	agent := findAIAgent(name)
+	if agent == nil {
+		ui.ShowMessage(fmt.Sprintf("Agent %q not found", name))
+		return
+	}
+
+	form := tview.NewForm()
+	closeForm := func() {
+		ui.Pages.RemovePage("params")
+		ui.RestoreFocus()
+	}
+
+	for _, param := range paramNames {
+		form.AddInputField(param, agent.Params.Get(param), 30, nil, nil)
+	}
+	form.AddButton("Save", func() {
+		var params GenerationParams
+		for _, param := range paramNames {
+			value := form.GetFormItemByLabel(param).(*tview.InputField).GetText()
+			if err := params.Set(param, value); err != nil {
+				ui.ShowMessage(err.Error())
+				return
+			}
+		}
+		closeForm()
+		if err := core.SetAgentParams(name, &params); err != nil {
+			ui.ShowMessage(fmt.Sprintf("Could not save parameters: %v", err))
+			return
+		}
+		ui.UpdateAIView(core)
+	})
+	form.AddButton("Reset", func() {
+		closeForm()
+		if err := core.SetAgentParams(name, nil); err != nil {
+			ui.ShowMessage(fmt.Sprintf("Could not reset parameters: %v", err))
+			return
+		}
+		ui.UpdateAIView(core)
+	})
+	form.AddButton("Cancel", closeForm)
+	form.SetCancelFunc(closeForm)
+	form.SetBorder(true).SetTitle(fmt.Sprintf(" Parameters of %s (empty uses the provider default, stop is comma separated) ", tview.Escape(name)))
+
+	ui.Pages.AddPage("params", centered(form, 90, 2*len(paramNames)+5), true, true)
+	ui.App.SetFocus(form)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Title of the plan checklist
+const planTitle = " Plan: %s (Enter run step, space done, e edit, a add, d delete, K/J move, Esc close) "
+
+// MakePlan asks the first active agent for a plan and opens its checklist
+func (ui *UI) MakePlan(core *Core, goal string) {
+	ui.InputField.SetText("<planning...>", false)
+	ui.InputField.SetDisabled(true)
+
+	go func() {
+		plan, err := core.MakePlan(goal)
+
+		ui.App.QueueUpdateDraw(func() {
+			ui.InputField.SetText("", false)
+			ui.InputField.SetDisabled(false)
+			ui.RenderConversation(core)
+			ui.UpdateBackendServices()
+
+			if err != nil {
+				ui.AppendNote(fmt.Sprintf("Planning failed: %v", err))
+				return
+			}
+			ui.AppendNote(fmt.Sprintf("Planned %d steps, edit them before running the first", len(plan.Steps)))
+			ui.ShowPlan(core, 0)
+		})
+	}()
+}
+
+// ShowPlan shows the plan as a checklist that can be edited and reordered,
+// with selected as the current step.
+func (ui *UI) ShowPlan(core *Core, selected int) {
+	if core.PlanRunning() {
+		ui.AppendNote("A step is running, the plan opens once it is answered")
+		return
+	}
+	plan := core.GetPlan()
+	if plan == nil {
+		ui.AppendNote("There is no plan, make one with /plan <change>")
+		return
+	}
+
+	list := tview.NewList().ShowSecondaryText(false)
+	closePlan := func() {
+		ui.Pages.RemovePage("plan")
+		ui.RestoreFocus()
+	}
+	// Change the plan and redraw it, selecting the step edit returns
+	change := func(edit func(plan *Plan) int) {
+		index := list.GetCurrentItem()
+		if err := core.EditPlan(func(plan *Plan) { index = edit(plan) }); err != nil {
+			closePlan()
+			ui.AppendNote(fmt.Sprintf("Could not change the plan: %v", err))
+			return
+		}
+		ui.Pages.RemovePage("plan")
+		ui.ShowPlan(core, index)
+	}
+
+	for i, step := range plan.Steps {
+		i := i
+		list.AddItem(fmt.Sprintf("%s%d. %s", checkbox(step.Done), i+1, tview.Escape(step.Text)), "", 0, func() {
+			closePlan()
+			ui.RunPlanStep(core, i)
+		})
+	}
+	if selected >= 0 && selected < len(plan.Steps) {
+		list.SetCurrentItem(selected)
+	}
+
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		index := list.GetCurrentItem()
+		move := func(delta int) {
+			change(func(plan *Plan) int { return plan.Move(index, delta) })
+		}
+		switch {
+		case event.Key() == tcell.KeyUp && event.Modifiers() == tcell.ModShift:
+			move(-1)
+			return nil
+		case event.Key() == tcell.KeyDown && event.Modifiers() == tcell.ModShift:
+			move(1)
+			return nil
+		case event.Key() != tcell.KeyRune:
+			return event
+		}
+
+		switch event.Rune() {
+		case ' ':
+			change(func(plan *Plan) int {
+				if index < len(plan.Steps) {
+					plan.Steps[index].Done = !plan.Steps[index].Done
+				}
+				return index
+			})
+		case 'K':
+			move(-1)
+		case 'J':
+			move(1)
+		case 'e':
+			if index < len(plan.Steps) {
+				ui.editText("Step", plan.Steps[index].Text, func(text string) {
+					change(func(plan *Plan) int {
+						if text != "" && index < len(plan.Steps) {
+							plan.Steps[index].Text = text
+						}
+						return index
+					})
+				})
+			}
+		case 'a':
+			ui.editText("New step", "", func(text string) {
+				change(func(plan *Plan) int {
+					if text == "" {
+						return index
+					}
+					plan.Insert(index+1, text)
+					return index + 1
+				})
+			})
+		case 'd':
+			change(func(plan *Plan) int {
+				plan.Remove(index)
+				return index
+			})
+		default:
+			return event
+		}
+		return nil
+	})
+	list.SetDoneFunc(closePlan)
+	list.SetBorder(true).SetTitle(fmt.Sprintf(planTitle, tview.Escape(plan.Goal)))
+
+	ui.Pages.AddPage("plan", centered(list, 100, len(plan.Steps)+4), true, true)
+	ui.App.SetFocus(list)
+}
+
+// RunPlanStep has the plan's agent carry out a step, then asks for approval
+func (ui *UI) RunPlanStep(core *Core, index int) {
+	ui.InputField.SetText(fmt.Sprintf("<running step %d...>", index+1), false)
+	ui.InputField.SetDisabled(true)
+
+	go func() {
+		response, err := core.RunPlanStep(index)
+
+		ui.App.QueueUpdateDraw(func() {
+			ui.InputField.SetText("", false)
+			ui.InputField.SetDisabled(false)
+			ui.RenderConversation(core)
+			ui.UpdateBackendServices()
+
+			if err != nil {
+				ui.AppendNote(fmt.Sprintf("Step %d failed: %v", index+1, err))
+				return
+			}
+			ui.ApprovePlanStep(core, index, response)
+		})
+	}()
+}
+
+// ApprovePlanStep asks whether to accept a step's answer, applying its edits,
+// and whether to go on with the next step.
+func (ui *UI) ApprovePlanStep(core *Core, index int, response string) {
+	plan := core.GetPlan()
+	if plan == nil || index >= len(plan.Steps) {
+		ui.AppendNote(fmt.Sprintf("Step %d is no longer in the plan", index+1))
+		return
+	}
+	edits := parseFileEdits(response)
+
+	text := fmt.Sprintf("Step %d of %d is answered.", index+1, len(plan.Steps))
+	if len(edits) > 0 {
+		text += fmt.Sprintf(" Accepting applies its edits to %d file(s).", len(edits))
+	}
+
+	accept := func() bool {
+		if len(edits) > 0 {
+			result, err := core.ApplyEdits(edits, plan.Steps[index].Text)
+			if err != nil {
+				ui.ShowMessage(fmt.Sprintf("Could not apply edits: %v", err))
+				return false
+			}
+			ui.AppendNote(result)
+			ui.UpdateGitCommit()
+		}
+		core.CompletePlanStep(index)
+		return true
+	}
+	// The step just completed changed the plan, so read it again
+	nextStep := func() int {
+		if plan := core.GetPlan(); plan != nil {
+			return plan.NextStep()
+		}
+		return -1
+	}
+
+	modal := tview.NewModal().
+		SetText(text).
+		AddButtons([]string{"Accept and continue", "Accept", "Redo", "Stop"}).
+		SetDoneFunc(func(_ int, label string) {
+			ui.Pages.RemovePage("approve")
+			ui.RestoreFocus()
+
+			switch label {
+			case "Accept and continue":
+				if !accept() {
+					return
+				}
+				if next := nextStep(); next >= 0 {
+					ui.RunPlanStep(core, next)
+				} else {
+					ui.AppendNote("Plan finished")
+				}
+			case "Accept":
+				if accept() {
+					ui.ShowPlan(core, nextStep())
+				}
+			case "Redo":
+				ui.RunPlanStep(core, index)
+			default:
+				ui.ShowPlan(core, index)
+			}
+		})
+	ui.Pages.AddPage("approve", modal, false, true)
+	ui.App.SetFocus(modal)
+}
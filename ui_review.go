@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// severityColor returns the colour tag used for a review finding's severity
+func severityColor(severity string) string {
+	switch strings.ToLower(severity) {
+	case "error":
+		return "red"
+	case "warning":
+		return "yellow"
+	default:
+		return "aqua"
+	}
+}
+
+// ShowReview shows review findings next to a file viewer that jumps to each finding's line
+func (ui *UI) ShowReview(findings []ReviewFinding) {
+	list := tview.NewList().ShowSecondaryText(true)
+	list.SetBorder(true).SetTitle(fmt.Sprintf(" Findings (%d) ", len(findings)))
+
+	viewer := tview.NewTextView().SetDynamicColors(true).SetWrap(false)
+	viewer.SetBorder(true)
+
+	showFinding := func(index int) {
+		if index < 0 || index >= len(findings) {
+			return
+		}
+		finding := findings[index]
+		viewer.SetTitle(fmt.Sprintf(" %s:%d ", finding.File, finding.Line))
+
+		content, err := readFileContents(finding.File)
+		if err != nil {
+			viewer.SetText(tview.Escape(fmt.Sprintf("Could not open %s: %v", finding.File, err)))
+			return
+		}
+
+		var sb strings.Builder
+		for i, line := range strings.Split(content, "\n") {
+			number := fmt.Sprintf("%5d ", i+1)
+			if i+1 == finding.Line {
+				sb.WriteString(fmt.Sprintf("[black:%s]%s%s[-:-]\n", severityColor(finding.Severity), number, tview.Escape(line)))
+			} else {
+				sb.WriteString("[gray]" + number + "[-]" + tview.Escape(line) + "\n")
+			}
+		}
+		viewer.SetText(sb.String())
+
+		// Keep a few lines of context above the finding
+		_, _, _, height := viewer.GetInnerRect()
+		offset := finding.Line - height/3
+		if offset < 0 {
+			offset = 0
+		}
+		viewer.ScrollTo(offset, 0)
+	}
+
+	for _, finding := range findings {
+		title := fmt.Sprintf("[%s]%s[-] %s:%d", severityColor(finding.Severity), strings.ToUpper(finding.Severity), tview.Escape(finding.File), finding.Line)
+		list.AddItem(title, tview.Escape(finding.Message), 0, nil)
+	}
+	if len(findings) == 0 {
+		list.AddItem("No findings, looks good!", "", 0, nil)
+	}
+
+	list.SetChangedFunc(func(index int, _ string, _ string, _ rune) {
+		showFinding(index)
+	})
+	// Enter moves to the file viewer, Tab returns to the list
+	list.SetSelectedFunc(func(index int, _ string, _ string, _ rune) {
+		showFinding(index)
+		ui.App.SetFocus(viewer)
+	})
+
+	closeReview := func() {
+		ui.Pages.RemovePage("review")
+		ui.RestoreFocus()
+	}
+	list.SetDoneFunc(closeReview)
+	viewer.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			closeReview()
+			return
+		}
+		ui.App.SetFocus(list)
+	})
+
+	layout := tview.NewFlex().
+		AddItem(list, 0, 2, true).
+		AddItem(viewer, 0, 3, false)
+	layout.SetBorder(true).SetTitle(" Code Review (Enter to view, Esc to close) ")
+
+	ui.Pages.AddPage("review", layout, true, true)
+	ui.App.SetFocus(list)
+	showFinding(0)
+}
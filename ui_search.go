@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ShowSearch opens the search dialog over all saved sessions, running query if one is given
+func (ui *UI) ShowSearch(core *Core, query string) {
+	input := tview.NewInputField().SetLabel("Search: ").SetText(query)
+	input.SetBorder(true).SetTitle(" role:user|assistant agent:<name> after:YYYY-MM-DD before:YYYY-MM-DD ")
+
+	list := tview.NewList()
+	list.SetBorder(true).SetTitle(" Results ")
+
+	preview := tview.NewTextView().SetDynamicColors(true).SetWrap(true).SetWordWrap(true)
+	preview.SetBorder(true).SetTitle(" Preview ")
+
+	var results []SearchResult
+	var words []string
+
+	showPreview := func(index int) {
+		if index < 0 || index >= len(results) {
+			preview.SetText("")
+			return
+		}
+		doc := results[index].Doc
+		header := fmt.Sprintf("[gray]%s | %s | %s %s[-]\n\n", tview.Escape(doc.SessionName), doc.Time.Format("2006-01-02 15:04"), doc.Role, tview.Escape(doc.Agent))
+		preview.SetText(header + highlightWords(doc.Text, words)).ScrollToBeginning()
+	}
+
+	runSearch := func() {
+		list.Clear()
+		found, err := core.Search(input.GetText())
+		if err != nil {
+			preview.SetText(tview.Escape(err.Error()))
+			return
+		}
+		results = found
+		query, _ := parseSearchQuery(input.GetText())
+		words = query.Words
+
+		for _, result := range results {
+			doc := result.Doc
+			title := fmt.Sprintf("%s [gray]%s %s[-]", tview.Escape(doc.SessionName), doc.Time.Format("2006-01-02"), doc.Role)
+			list.AddItem(title, tview.Escape(result.Preview), 0, nil)
+		}
+		list.SetTitle(fmt.Sprintf(" Results (%d) ", len(results)))
+		if len(results) == 0 {
+			preview.SetText("No messages found")
+			return
+		}
+		showPreview(0)
+		ui.App.SetFocus(list)
+	}
+
+	closeSearch := func() {
+		ui.Pages.RemovePage("search")
+		ui.RestoreFocus()
+	}
+
+	input.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			runSearch()
+		case tcell.KeyEscape:
+			closeSearch()
+		case tcell.KeyTab:
+			ui.App.SetFocus(list)
+		}
+	})
+	list.SetChangedFunc(func(index int, _ string, _ string, _ rune) {
+		showPreview(index)
+	})
+	list.SetSelectedFunc(func(index int, _ string, _ string, _ rune) {
+		doc := results[index].Doc
+		closeSearch()
+		ui.OpenMessage(core, doc.Session, doc.Message)
+	})
+	list.SetDoneFunc(closeSearch)
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyTab || event.Key() == tcell.KeyBacktab {
+			ui.App.SetFocus(input)
+			return nil
+		}
+		return event
+	})
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(input, 3, 0, true).
+		AddItem(tview.NewFlex().
+			AddItem(list, 0, 2, false).
+			AddItem(preview, 0, 3, false), 0, 1, false)
+	layout.SetBorder(true).SetTitle(" Search sessions (Enter to search or open, Tab to switch, Esc to close) ")
+
+	ui.Pages.AddPage("search", layout, true, true)
+	ui.App.SetFocus(input)
+	if query != "" {
+		runSearch()
+	}
+}
+
+// highlightWords escapes text for a TextView and highlights the searched words
+func highlightWords(text string, words []string) string {
+	if len(words) == 0 {
+		return tview.Escape(text)
+	}
+	var quoted []string
+	for _, word := range words {
+		quoted = append(quoted, regexp.QuoteMeta(word))
+	}
+	pattern := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	var sb strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		sb.WriteString(tview.Escape(text[last:match[0]]))
+		sb.WriteString("[black:yellow]" + tview.Escape(text[match[0]:match[1]]) + "[-:-]")
+		last = match[1]
+	}
+	sb.WriteString(tview.Escape(text[last:]))
+	return sb.String()
+}
+
+// OpenMessage resumes a session at a message and selects it in Chat Tracking
+func (ui *UI) OpenMessage(core *Core, sessionID, messageID string) {
+	session, err := core.OpenMessage(sessionID, messageID)
+	if err != nil {
+		ui.ShowMessage(fmt.Sprintf("Could not open message: %v", err))
+		return
+	}
+	ui.LoadSession(core, session)
+	ui.focusPrimitive(ui.ChatTracking)
+	ui.SelectMessage(messageID)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rivo/tview"
+)
+
+// ShowSessionPicker lets the user start a new session or resume a saved one
+func (ui *UI) ShowSessionPicker(core *Core) {
+	sessions, err := listSessions(core.projectDir)
+	if err != nil {
+		ui.ShowMessage(fmt.Sprintf("Could not list sessions: %v", err))
+		return
+	}
+
+	list := tview.NewList().ShowSecondaryText(false)
+	closePicker := func() {
+		ui.Pages.RemovePage("sessions")
+		ui.RestoreFocus()
+	}
+
+	list.AddItem("New session", "", 'n', func() {
+		closePicker()
+		ui.LoadSession(core, core.NewSession())
+	})
+	for _, session := range sessions {
+		session := session
+		list.AddItem(tview.Escape(session.Summary()), "", 0, func() {
+			closePicker()
+			ui.ResumeSession(core, session.ID)
+		})
+	}
+	list.SetDoneFunc(closePicker)
+	list.SetBorder(true).SetTitle(" Sessions (Enter to open, Esc to keep the current one) ")
+
+	ui.Pages.AddPage("sessions", centered(list, 80, 20), true, true)
+	ui.App.SetFocus(list)
+}
+
+// ResumeSession loads a saved session into the UI
+func (ui *UI) ResumeSession(core *Core, id string) {
+	session, err := core.ResumeSession(id)
+	if err != nil {
+		ui.ShowMessage(fmt.Sprintf("Could not resume session: %v", err))
+		return
+	}
+	ui.LoadSession(core, session)
+}
+
+// LoadSession shows a session's conversation and restores its active agents and files
+func (ui *UI) LoadSession(core *Core, session *Session) {
+	// Make sure every agent and file has a node before restoring them
+	core.Update()
+	ui.UpdateAIView(core)
+	ui.UpdateTrackedFiles(core)
+
+	for _, node := range ui.AIViewRoot.GetChildren() {
+		agentNode, ok := node.GetReference().(*AIAgentNode)
+		if !ok {
+			continue
+		}
+		ui.setAgentActive(core, node, agentNode, contains(session.ActiveAgents, agentNode.Name))
+	}
+	for _, node := range ui.FileRoot.GetChildren() {
+		fileNode, ok := node.GetReference().(*FileNode)
+		if !ok {
+			continue
+		}
+		ui.setFileActive(node, fileNode, contains(session.ActiveFiles, fileNode.Name))
+	}
+
+	ui.ResetChat()
+	ui.AppendNote("Session " + session.Name)
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os/exec"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gdamore/tcell/v2"
 	git "github.com/go-git/go-git/v5"
@@ -103,7 +105,7 @@ func GenerateTitle(fileNames []string, path string, date time.Time) string {
 	}
 
 	// Use AI to generate a title
-	title, _ := getChatCompletion(stack.getAllMessages(), GetService("gpt-3.5", "gpt-3.5-turbo"))
+	title, _ := getChatCompletion(stack.getAllMessages(), GetService("gpt-3.5", "gpt-3.5-turbo"), defaultGenerationParams())
 
 	return title
 }
@@ -136,6 +138,10 @@ func DetermineColorBasedOnStatus(status string) tcell.Color {
 		return tcell.ColorYellow // Modified
 	case status == "Unmodified":
 		return tcell.ColorGreen // Tracked
+	case status == "Staged":
+		return tcell.ColorAqua // Staged
+	case status == "Partially Staged":
+		return tcell.ColorOrange // Staged with further unstaged changes
 	case status == "Untracked":
 		return tcell.ColorGray // Untracked
 	case status == "Directory":
@@ -145,6 +151,49 @@ func DetermineColorBasedOnStatus(status string) tcell.Color {
 	}
 }
 
+// contains reports whether list includes value.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateToTokens shortens content to roughly the given number of tokens.
+func truncateToTokens(content string, tokens int) string {
+	limit := tokens * 4 // 1 token is approximately 4 characters
+	if tokens <= 0 || len(content) <= limit {
+		return content
+	}
+	// Cut at the start of a character, not in the middle of one
+	for limit > 0 && !utf8.RuneStart(content[limit]) {
+		limit--
+	}
+	return content[:limit] + "\n... (truncated)"
+}
+
+// copyToClipboard copies text to the system clipboard using whichever clipboard tool is installed.
+func copyToClipboard(text string) error {
+	tools := [][]string{
+		{"pbcopy"},
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+		{"clip.exe"},
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(tool[0], tool[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return fmt.Errorf("no clipboard tool found (install xclip, xsel or wl-copy)")
+}
+
 func checkError(err error, msg string) {
 	if err != nil {
 		log.Fatalf("%s: %v", msg, err)
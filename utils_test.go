@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateToTokens(t *testing.T) {
+	tests := []struct {
+		content string
+		tokens  int
+		want    string
+	}{
+		{"short", 10, "short"},
+		{"abcdefghij", 0, "abcdefghij"},
+		{"abcdefghij", 2, "abcdefgh\n... (truncated)"},
+		{"aaaaaaé", 1, "aaaa\n... (truncated)"},
+		{"aaaéééé", 1, "aaa\n... (truncated)"},
+		{"日本語です", 1, "日\n... (truncated)"},
+	}
+
+	for _, tt := range tests {
+		got := truncateToTokens(tt.content, tt.tokens)
+		if got != tt.want {
+			t.Errorf("truncateToTokens(%q, %d): got %q, want %q", tt.content, tt.tokens, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateToTokens(%q, %d): got invalid UTF-8 %q", tt.content, tt.tokens, got)
+		}
+	}
+}